@@ -0,0 +1,128 @@
+// Package apigateway 在lambda里通过API Gateway的proxy integration运行http.Handler
+package apigateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Handler 把http.Handler包装成lambda handler. manager不为nil时, 返回之前等待它在后台执行的handler,
+// 否则lambda返回之后进程被冻结, handler就不会执行了.
+//
+// 注意API Gateway要等lambda返回才回复slack, 所以WithWorkers在lambda里做不到立即回复:
+// slack还是要等handler执行完, slash command和交互回调超过3秒一样会显示超时.
+// 在lambda里WithWorkers只能限制并发和单个handler的超时. 慢的handler要先用Context的response_url或者
+// Web API回复, 或者拆到另一个异步调用(InvocationType: Event)的lambda里
+func Handler(h http.Handler, manager *slackbot.Manager) func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		r, err := newRequest(ctx, req)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest}, err
+		}
+
+		w := newResponseWriter()
+		h.ServeHTTP(w, r)
+
+		if manager != nil {
+			if err := manager.Drain(ctx); err != nil {
+				return w.response(), errors.Wrap(err, "等待后台handler超时")
+			}
+		}
+
+		return w.response(), nil
+	}
+}
+
+func newRequest(ctx context.Context, req events.APIGatewayProxyRequest) (*http.Request, error) {
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "body不是合法的base64")
+		}
+		body = decoded
+	}
+
+	query := url.Values{}
+	for k, v := range req.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, vs := range req.MultiValueQueryStringParameters {
+		query[k] = vs
+	}
+
+	u := &url.URL{Path: req.Path, RawQuery: query.Encode()}
+
+	r, err := http.NewRequest(req.HTTPMethod, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "创建http请求失败")
+	}
+
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+	for k, vs := range req.MultiValueHeaders {
+		r.Header.Del(k)
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+
+	r.Host = r.Header.Get("Host")
+	r.RemoteAddr = req.RequestContext.Identity.SourceIP
+
+	return r.WithContext(ctx), nil
+}
+
+type responseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: http.Header{}}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *responseWriter) response() events.APIGatewayProxyResponse {
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	headers := make(map[string]string)
+	for k, vs := range w.header {
+		headers[k] = strings.Join(vs, ",")
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:        code,
+		Headers:           headers,
+		MultiValueHeaders: map[string][]string(w.header),
+		Body:              w.body.String(),
+	}
+}
@@ -0,0 +1,62 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	m := slackbot.New("", "verify", slackbot.WithWorkers(1, time.Second))
+
+	var got *slack.SlashCommand
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		time.Sleep(10 * time.Millisecond)
+		got = cmd
+	})
+
+	body := url.Values{"token": {"verify"}, "command": {"/ucb"}, "text": {"build ios"}}.Encode()
+
+	resp, err := Handler(m.Handler(), m)(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:      http.MethodPost,
+		Path:            "/command",
+		Headers:         map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		Body:            base64.StdEncoding.EncodeToString([]byte(body)),
+		IsBase64Encoded: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status: %d body: %s", resp.StatusCode, resp.Body)
+	}
+
+	// 返回之前已经等后台的handler执行完
+	if got == nil || got.Text != "build ios" {
+		t.Errorf("unexpected command: %+v", got)
+	}
+}
+
+func TestHandlerNotFound(t *testing.T) {
+	m := slackbot.New("", "verify")
+
+	resp, err := Handler(m.Handler(), nil)(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:            http.MethodGet,
+		Path:                  "/unknown",
+		QueryStringParameters: map[string]string{"a": "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status: %d", resp.StatusCode)
+	}
+}
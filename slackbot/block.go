@@ -1,30 +1,101 @@
 package slackbot
 
 import (
-	"bytes"
-	"encoding/json"
+	"container/list"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
-	"html"
+	"sync"
 	"text/template"
 )
 
-func NewBlockMessage(block string, params interface{}) (*slack.Blocks, error){
-	tplt, err := template.New("n").Funcs(template.FuncMap{"EscapeString": html.EscapeString}).Parse(block)
-	if err != nil{
-		return nil, errors.Wrap(err, "解析block失败")
+// maxParsedBlocks 最多缓存多少个NewBlockMessage解析过的template. 常驻的template用BlockTemplates管理
+const maxParsedBlocks = 128
+
+// parsedBlocks NewBlockMessage解析过的template, key是template本身.
+// 调用的人可能每次拼出不同的template, 只保留最近用过的maxParsedBlocks个
+var parsedBlocks = newBlockCache(maxParsedBlocks)
+
+type blockCache struct{
+	lock  sync.Mutex
+	limit int
+	// order 最近用过的在前面, 元素是*blockCacheEntry
+	order *list.List
+	items map[string]*list.Element
+}
+
+type blockCacheEntry struct{
+	key      string
+	template *template.Template
+}
+
+func newBlockCache(limit int) *blockCache{
+	return &blockCache{
+		limit: limit,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *blockCache) get(key string) (*template.Template, bool){
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, has := c.items[key]
+	if !has{
+		return nil, false
 	}
+	c.order.MoveToFront(e)
+	return e.Value.(*blockCacheEntry).template, true
+}
 
-	buf := &bytes.Buffer{}
-	if err :=tplt.Execute(buf, params); err != nil{
-		return nil, errors.Wrap(err, "template执行失败")
+func (c *blockCache) add(key string, tplt *template.Template){
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, has := c.items[key]; has{
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&blockCacheEntry{key: key, template: tplt})
+	for c.order.Len() > c.limit{
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*blockCacheEntry).key)
 	}
+}
+
+func (c *blockCache) len() int{
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
-	result := &slack.Blocks{}
+	return c.order.Len()
+}
+
+// NewBlockMessage template里的T不翻译, 只按fmt填参数. 需要翻译时用Context.NewBlockMessage.
+// 值里可能有引号或者换行时用EscapeJSON, 不要用EscapeString
+func NewBlockMessage(block string, params interface{}) (*slack.Blocks, error){
+	return newBlockMessage(block, params, untranslated)
+}
+
+func untranslated(format string, args ...interface{}) string{
+	if len(args) == 0{
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
 
-	if err := json.Unmarshal(buf.Bytes(), result); err != nil{
-		return nil, errors.Wrap(err, "json解析为blocks出错")
+func newBlockMessage(block string, params interface{}, t Translator) (*slack.Blocks, error){
+	tplt, has := parsedBlocks.get(block)
+	if !has{
+		parsed, err := template.New("n").Funcs(blockFuncs(untranslated)).Parse(block)
+		if err != nil{
+			return nil, errors.Wrap(err, "解析block失败")
+		}
+		parsedBlocks.add(block, parsed)
+		tplt = parsed
 	}
 
-	return result, nil
-}
\ No newline at end of file
+	return executeBlocks(tplt, "n", params, t, false)
+}
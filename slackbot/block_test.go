@@ -1,6 +1,10 @@
 package slackbot
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"text/template"
+)
 
 func TestBlockMessage(t *testing.T) {
 	msg := `[
@@ -69,3 +73,38 @@ func TestBlockMessage(t *testing.T) {
 	}
 }
 
+
+func TestBlockCacheLimit(t *testing.T) {
+	cache := newBlockCache(2)
+	a, b, c := template.New("a"), template.New("b"), template.New("c")
+
+	cache.add("a", a)
+	cache.add("b", b)
+	if got, _ := cache.get("a"); got != a {
+		t.Fatal("a not cached")
+	}
+
+	// b最久没用, 被挤出去
+	cache.add("c", c)
+	if cache.len() != 2 {
+		t.Errorf("unexpected len: %d", cache.len())
+	}
+	if _, has := cache.get("b"); has {
+		t.Error("b should be evicted")
+	}
+	if got, _ := cache.get("a"); got != a {
+		t.Error("a should be kept")
+	}
+	if got, _ := cache.get("c"); got != c {
+		t.Error("c should be kept")
+	}
+
+	for i := 0; i < maxParsedBlocks*2; i++ {
+		if _, err := NewBlockMessage(fmt.Sprintf(`[{"type":"divider","block_id":"%d"}]`, i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if parsedBlocks.len() > maxParsedBlocks {
+		t.Errorf("parsedBlocks not bounded: %d", parsedBlocks.len())
+	}
+}
@@ -0,0 +1,268 @@
+package slackbot
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// BlockBuilder 用代码拼blocks, 不用手写json:
+//
+//	Blocks().
+//		Section(Mrkdwn("*"+EscapeMrkdwn(tag)+"* 启动成功")).Fields(Mrkdwn(fmt.Sprintf("*Build:*\n%d", build))).
+//		Actions(Button("cancel_build", "取消").Danger().Confirm(Confirm("确认", "确定要取消构建吗?", "Yes", "No"))).
+//		Build()
+//
+// Fields和Accessory加到最后一个section上, 最后一个block不是section时新建一个
+type BlockBuilder struct {
+	blocks []slack.Block
+}
+
+// Blocks 可以从已有的blocks开始, 比如NewBlockMessage的结果: Blocks(message.BlockSet...)
+func Blocks(blocks ...slack.Block) *BlockBuilder {
+	return &BlockBuilder{blocks: append([]slack.Block(nil), blocks...)}
+}
+
+// Build 返回的blocks可以直接用在slack.MsgOptionBlocks或者NewModalViewWithBlocks里
+func (b *BlockBuilder) Build() *slack.Blocks {
+	return &slack.Blocks{BlockSet: b.blocks}
+}
+
+// Validate 见ValidateBlocks
+func (b *BlockBuilder) Validate() error {
+	return ValidateBlocks(b.blocks)
+}
+
+// Add 加入其它地方生成的blocks
+func (b *BlockBuilder) Add(blocks ...slack.Block) *BlockBuilder {
+	b.blocks = append(b.blocks, blocks...)
+	return b
+}
+
+func (b *BlockBuilder) Section(text *slack.TextBlockObject) *BlockBuilder {
+	return b.Add(slack.NewSectionBlock(text, nil, nil))
+}
+
+func (b *BlockBuilder) Fields(fields ...*slack.TextBlockObject) *BlockBuilder {
+	section := b.lastSection()
+	section.Fields = append(section.Fields, fields...)
+	return b
+}
+
+func (b *BlockBuilder) Accessory(element slack.BlockElement) *BlockBuilder {
+	b.lastSection().Accessory = slack.NewAccessory(unwrapElement(element))
+	return b
+}
+
+func (b *BlockBuilder) lastSection() *slack.SectionBlock {
+	if len(b.blocks) > 0 {
+		if section, ok := b.blocks[len(b.blocks)-1].(*slack.SectionBlock); ok {
+			return section
+		}
+	}
+
+	section := slack.NewSectionBlock(nil, nil, nil)
+	b.blocks = append(b.blocks, section)
+	return section
+}
+
+func (b *BlockBuilder) Header(text string) *BlockBuilder {
+	return b.Add(slack.NewHeaderBlock(PlainText(text)))
+}
+
+func (b *BlockBuilder) Divider() *BlockBuilder {
+	return b.Add(slack.NewDividerBlock())
+}
+
+// Context elements是文字或者ImageElement
+func (b *BlockBuilder) Context(elements ...slack.MixedElement) *BlockBuilder {
+	return b.Add(slack.NewContextBlock("", elements...))
+}
+
+func (b *BlockBuilder) Image(imageURL, altText string) *BlockBuilder {
+	return b.Add(slack.NewImageBlock(imageURL, altText, "", nil))
+}
+
+func (b *BlockBuilder) Actions(elements ...slack.BlockElement) *BlockBuilder {
+	unwrapped := make([]slack.BlockElement, len(elements))
+	for i, element := range elements {
+		unwrapped[i] = unwrapElement(element)
+	}
+	return b.Add(slack.NewActionBlock("", unwrapped...))
+}
+
+// Input 只能用在modal里. blockID和element的action_id决定了view.State.Values里的key
+func (b *BlockBuilder) Input(blockID, label string, element slack.BlockElement, optional bool) *BlockBuilder {
+	input := slack.NewInputBlock(blockID, PlainText(label), unwrapElement(element))
+	input.Optional = optional
+	return b.Add(input)
+}
+
+// BlockID 设置最后一个block的block_id
+func (b *BlockBuilder) BlockID(id string) *BlockBuilder {
+	if len(b.blocks) == 0 {
+		return b
+	}
+
+	switch block := b.blocks[len(b.blocks)-1].(type) {
+	case *slack.SectionBlock:
+		block.BlockID = id
+	case *slack.ActionBlock:
+		block.BlockID = id
+	case *slack.ContextBlock:
+		block.BlockID = id
+	case *slack.HeaderBlock:
+		block.BlockID = id
+	case *slack.DividerBlock:
+		block.BlockID = id
+	case *slack.ImageBlock:
+		block.BlockID = id
+	case *slack.InputBlock:
+		block.BlockID = id
+	}
+	return b
+}
+
+// Mrkdwn 文字里有用户输入时记得EscapeMrkdwn
+func Mrkdwn(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+func PlainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
+
+// EscapeMrkdwn 转义&<>, 避免用户输入被当成链接或者mention
+func EscapeMrkdwn(text string) string {
+	return escapeMrkdwn(text)
+}
+
+// Confirm 按钮和菜单的确认对话框
+func Confirm(title, text, confirm, deny string) *slack.ConfirmationBlockObject {
+	return slack.NewConfirmationBlockObject(PlainText(title), Mrkdwn(text), PlainText(confirm), PlainText(deny))
+}
+
+func Option(value, text string) *slack.OptionBlockObject {
+	return slack.NewOptionBlockObject(value, PlainText(text), nil)
+}
+
+// wrappedElement 给slack的element加上链式调用的方法, 放进blocks之前要还原
+type wrappedElement interface {
+	unwrap() slack.BlockElement
+}
+
+func unwrapElement(element slack.BlockElement) slack.BlockElement {
+	if w, ok := element.(wrappedElement); ok {
+		return w.unwrap()
+	}
+	return element
+}
+
+type ButtonElement struct {
+	*slack.ButtonBlockElement
+}
+
+func Button(actionID, text string) ButtonElement {
+	return ButtonElement{slack.NewButtonBlockElement(actionID, "", PlainText(text))}
+}
+
+func (e ButtonElement) unwrap() slack.BlockElement { return e.ButtonBlockElement }
+
+func (e ButtonElement) Value(value string) ButtonElement {
+	e.ButtonBlockElement.Value = value
+	return e
+}
+
+func (e ButtonElement) URL(url string) ButtonElement {
+	e.ButtonBlockElement.URL = url
+	return e
+}
+
+func (e ButtonElement) Primary() ButtonElement {
+	e.Style = slack.StylePrimary
+	return e
+}
+
+func (e ButtonElement) Danger() ButtonElement {
+	e.Style = slack.StyleDanger
+	return e
+}
+
+func (e ButtonElement) Confirm(confirm *slack.ConfirmationBlockObject) ButtonElement {
+	e.ButtonBlockElement.Confirm = confirm
+	return e
+}
+
+type OverflowElement struct {
+	*slack.OverflowBlockElement
+}
+
+// Overflow 右边的...菜单, 2到5个选项
+func Overflow(actionID string, options ...*slack.OptionBlockObject) OverflowElement {
+	return OverflowElement{slack.NewOverflowBlockElement(actionID, options...)}
+}
+
+func (e OverflowElement) unwrap() slack.BlockElement { return e.OverflowBlockElement }
+
+func (e OverflowElement) Confirm(confirm *slack.ConfirmationBlockObject) OverflowElement {
+	e.OverflowBlockElement.Confirm = confirm
+	return e
+}
+
+type SelectElement struct {
+	*slack.SelectBlockElement
+}
+
+func StaticSelect(actionID, placeholder string, options ...*slack.OptionBlockObject) SelectElement {
+	return SelectElement{slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, PlainText(placeholder), actionID, options...)}
+}
+
+// ExternalSelect 选项由block_suggestion请求动态返回
+func ExternalSelect(actionID, placeholder string) SelectElement {
+	return SelectElement{slack.NewOptionsSelectBlockElement(slack.OptTypeExternal, PlainText(placeholder), actionID)}
+}
+
+func UsersSelect(actionID, placeholder string) SelectElement {
+	return SelectElement{slack.NewOptionsSelectBlockElement(slack.OptTypeUser, PlainText(placeholder), actionID)}
+}
+
+func ChannelsSelect(actionID, placeholder string) SelectElement {
+	return SelectElement{slack.NewOptionsSelectBlockElement(slack.OptTypeChannels, PlainText(placeholder), actionID)}
+}
+
+func ConversationsSelect(actionID, placeholder string) SelectElement {
+	return SelectElement{slack.NewOptionsSelectBlockElement(slack.OptTypeConversations, PlainText(placeholder), actionID)}
+}
+
+func (e SelectElement) unwrap() slack.BlockElement { return e.SelectBlockElement }
+
+// Initial 初始选项. static select的value不在options里时不设置, 数据里的值可能已经不是选项了.
+// external select没有静态的options, 显示的文字就是value, 要显示别的文字用InitialWithText
+func (e SelectElement) Initial(value string) SelectElement {
+	if e.Type == slack.OptTypeExternal {
+		return e.InitialWithText(value, value)
+	}
+
+	for _, option := range e.Options {
+		if option.Value == value {
+			e.SelectBlockElement.InitialOption = option
+			return e
+		}
+	}
+	return e
+}
+
+// InitialWithText 直接设置初始选项, 不检查options. 一般用于external select
+func (e SelectElement) InitialWithText(value, text string) SelectElement {
+	e.SelectBlockElement.InitialOption = Option(value, text)
+	return e
+}
+
+// MinQueryLength external select输入几个字符之后才请求选项
+func (e SelectElement) MinQueryLength(n int) SelectElement {
+	e.SelectBlockElement.MinQueryLength = &n
+	return e
+}
+
+func (e SelectElement) Confirm(confirm *slack.ConfirmationBlockObject) SelectElement {
+	e.SelectBlockElement.Confirm = confirm
+	return e
+}
@@ -0,0 +1,148 @@
+package slackbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+// assertBlocksJSON 按json的结构比较, 不比较空格和字段顺序
+func assertBlocksJSON(t *testing.T, blocks *slack.Blocks, expect string) {
+	t.Helper()
+
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got, want interface{}
+	json.Unmarshal(data, &got)
+	if err := json.Unmarshal([]byte(expect), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected json:\n%s", data)
+	}
+}
+
+func TestBuilderSectionAndActions(t *testing.T) {
+	blocks := Blocks().
+		Header("构建").
+		Section(Mrkdwn("*"+EscapeMrkdwn("ios")+"* 启动成功")).Fields(Mrkdwn(fmt.Sprintf("*Build:*\n%d", 12)), PlainText("clean")).
+		Accessory(Overflow("more", Option("log", "查看日志"), Option("install", "安装"))).
+		Divider().
+		Actions(
+			Button("cancel_build", "取消").Value("12_ios").Danger().Confirm(Confirm("确认", "确定要取消构建吗?", "Yes", "No")),
+			Button("open", "打开").URL("https://example.com").Primary(),
+			StaticSelect("target", "选择目标", Option("ios", "iOS"), Option("android", "Android")).Initial("android"),
+		).BlockID("build_actions").
+		Context(Mrkdwn("by <@U1>")).
+		Build()
+
+	assertBlocksJSON(t, blocks, `[
+		{"type": "header", "text": {"type": "plain_text", "text": "构建"}},
+		{
+			"type": "section",
+			"text": {"type": "mrkdwn", "text": "*ios* 启动成功"},
+			"fields": [
+				{"type": "mrkdwn", "text": "*Build:*\n12"},
+				{"type": "plain_text", "text": "clean"}
+			],
+			"accessory": {
+				"type": "overflow",
+				"action_id": "more",
+				"options": [
+					{"text": {"type": "plain_text", "text": "查看日志"}, "value": "log"},
+					{"text": {"type": "plain_text", "text": "安装"}, "value": "install"}
+				]
+			}
+		},
+		{"type": "divider"},
+		{
+			"type": "actions",
+			"block_id": "build_actions",
+			"elements": [
+				{
+					"type": "button",
+					"action_id": "cancel_build",
+					"text": {"type": "plain_text", "text": "取消"},
+					"value": "12_ios",
+					"style": "danger",
+					"confirm": {
+						"title": {"type": "plain_text", "text": "确认"},
+						"text": {"type": "mrkdwn", "text": "确定要取消构建吗?"},
+						"confirm": {"type": "plain_text", "text": "Yes"},
+						"deny": {"type": "plain_text", "text": "No"}
+					}
+				},
+				{"type": "button", "action_id": "open", "text": {"type": "plain_text", "text": "打开"}, "url": "https://example.com", "style": "primary"},
+				{
+					"type": "static_select",
+					"action_id": "target",
+					"placeholder": {"type": "plain_text", "text": "选择目标"},
+					"options": [
+						{"text": {"type": "plain_text", "text": "iOS"}, "value": "ios"},
+						{"text": {"type": "plain_text", "text": "Android"}, "value": "android"}
+					],
+					"initial_option": {"text": {"type": "plain_text", "text": "Android"}, "value": "android"}
+				}
+			]
+		},
+		{"type": "context", "elements": [{"type": "mrkdwn", "text": "by <@U1>"}]}
+	]`)
+
+	if err := ValidateBlocks(blocks.BlockSet); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuilderWithTemplate(t *testing.T) {
+	message, err := NewBlockMessage(`[{"type": "section", "text": {"type": "mrkdwn", "text": "{{EscapeJSON .}}"}}]`, "模板")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模板的结果后面继续拼, fields加到模板的section上
+	blocks := Blocks(message.BlockSet...).Fields(Mrkdwn("a")).
+		Input("tag", "构建目标", ExternalSelect("value", "搜索").MinQueryLength(2), false).
+		Build()
+
+	assertBlocksJSON(t, blocks, `[
+		{"type": "section", "text": {"type": "mrkdwn", "text": "模板"}, "fields": [{"type": "mrkdwn", "text": "a"}]},
+		{
+			"type": "input",
+			"block_id": "tag",
+			"label": {"type": "plain_text", "text": "构建目标"},
+			"element": {"type": "external_select", "action_id": "value", "placeholder": {"type": "plain_text", "text": "搜索"}, "min_query_length": 2}
+		}
+	]`)
+
+	// json往返之后还是slack自己的类型
+	data, _ := json.Marshal(blocks)
+	var parsed slack.Blocks
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.BlockSet[1].(*slack.InputBlock).Element.(*slack.SelectBlockElement); !ok {
+		t.Errorf("unexpected element: %T", parsed.BlockSet[1].(*slack.InputBlock).Element)
+	}
+}
+
+func TestSelectInitial(t *testing.T) {
+	// 数据里的值不在选项里时不设置, 不能panic
+	if e := StaticSelect("target", "选择目标", Option("ios", "iOS")).Initial("web"); e.InitialOption != nil {
+		t.Errorf("unknown value should be skipped: %+v", e.InitialOption)
+	}
+
+	if e := ExternalSelect("target", "选择目标").Initial("ios"); e.InitialOption == nil || e.InitialOption.Value != "ios" {
+		t.Errorf("external select should accept any value: %+v", e.InitialOption)
+	}
+
+	e := ExternalSelect("target", "选择目标").InitialWithText("ios", "iOS")
+	if e.InitialOption.Value != "ios" || e.InitialOption.Text.Text != "iOS" {
+		t.Errorf("unexpected initial option: %+v", e.InitialOption)
+	}
+}
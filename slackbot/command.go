@@ -0,0 +1,173 @@
+package slackbot
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// registration 命令和回调共有的注册信息
+type registration struct {
+	name        string
+	priority    int
+	description string
+	usage       string
+	policy      *Policy
+	timeout     time.Duration
+	cacheTTL    time.Duration
+	includeBots bool
+	channels    []string
+	// metadataChannel 见MetadataChannel
+	metadataChannel bool
+}
+
+type registerOption func(*registration)
+
+type mentionCommand struct {
+	registration
+
+	pattern string
+	reg     *regexp.Regexp
+	process Command
+
+	// spec 只有用RegisterCommand注册的命令才有
+	spec *commandSpec
+}
+
+// callbackRegistration 命令以外的注册信息. 用于help和权限
+type callbackRegistration struct {
+	registration
+
+	kind string
+	id   string
+	// pattern id里有{name}参数时才有
+	pattern *idPattern
+}
+
+// Priority 多个pattern都能匹配时, priority大的优先. 相同priority按注册顺序. 只对命令有效
+func Priority(priority int) registerOption {
+	return func(r *registration) {
+		r.priority = priority
+	}
+}
+
+// Name 查找权限配置用的名字. 不设置时命令是pattern, RegisterCommand注册的是spec.Name, 回调是callback id.
+// 同一个操作有几个入口时设置成同一个名字, 一条配置就能管住所有入口
+func Name(name string) registerOption {
+	return func(r *registration) {
+		r.name = name
+	}
+}
+
+// MetadataChannel view的private_metadata是发起的channel id. view的回调本身没有channel,
+// 设置之后权限检查的allow_channels, deny_channels和Context.Channel都用这个channel. 只对view submission和view closed有效
+func MetadataChannel() registerOption {
+	return func(r *registration) {
+		r.metadataChannel = true
+	}
+}
+
+// Description 显示在help里的说明
+func Description(description string) registerOption {
+	return func(r *registration) {
+		r.description = description
+	}
+}
+
+// Usage 显示在help里的用法, 比如 ping [text]. 用RegisterCommand注册的命令会自动生成
+func Usage(usage string) registerOption {
+	return func(r *registration) {
+		r.usage = usage
+	}
+}
+
+// WithStrictRouting 一条消息匹配到多个pattern时打印出来, 方便发现有歧义的pattern
+func WithStrictRouting() option {
+	return func(manager *Manager) {
+		manager.strictRouting = true
+	}
+}
+
+// RegisterMentionCommand 注册时就编译pattern, 非法的正则或者重复注册会返回错误
+func (m *Manager) RegisterMentionCommand(reg string, cmd Command, options ...registerOption) error {
+	return m.registerMentionCommand(reg, cmd, nil, options)
+}
+
+func (m *Manager) registerMentionCommand(reg string, cmd Command, spec *commandSpec, options []registerOption) error {
+	for _, c := range m.commands {
+		if c.pattern == reg {
+			return errors.New("重复注册了command: " + reg)
+		}
+	}
+
+	compiled, err := regexp.Compile(reg)
+	if err != nil {
+		return errors.Wrapf(err, "command不是合法的正则: %s", reg)
+	}
+
+	command := &mentionCommand{
+		pattern: reg,
+		reg:     compiled,
+		process: cmd,
+		spec:    spec,
+	}
+
+	for _, ops := range options {
+		ops(&command.registration)
+	}
+
+	m.commands = append(m.commands, command)
+
+	// stable排序保证相同priority时保持注册顺序
+	sort.SliceStable(m.commands, func(i, j int) bool {
+		return m.commands[i].priority > m.commands[j].priority
+	})
+
+	return nil
+}
+
+func (m *Manager) addCallbackRegistration(kind, id string, options []registerOption) {
+	h := &callbackRegistration{kind: kind, id: id, pattern: compileIDPattern(id)}
+	for _, ops := range options {
+		ops(&h.registration)
+	}
+	m.callbacks = append(m.callbacks, h)
+}
+
+func (m *Manager) findCallbackRegistration(kind, id string) *registration {
+	for _, h := range m.callbacks {
+		if h.kind == kind && h.id == id {
+			return &h.registration
+		}
+	}
+	return nil
+}
+
+// MatchMentionCommands 按路由顺序返回所有能匹配text的pattern, 第一个就是实际会执行的. 可以在测试里检查pattern是否有歧义
+func (m *Manager) MatchMentionCommands(text string) []string {
+	var result []string
+	for _, c := range m.commands {
+		if c.reg.MatchString(text) {
+			result = append(result, c.pattern)
+		}
+	}
+	return result
+}
+
+// matchMentionCommand 返回第一个匹配的command和submatch, 都不匹配时返回nil
+func (m *Manager) matchMentionCommand(text string) (*mentionCommand, []string) {
+	if m.strictRouting {
+		if matched := m.MatchMentionCommands(text); len(matched) > 1 {
+			m.logger.Warn("命令匹配到多个pattern, 使用第一个", Fields{"text": text, "patterns": matched})
+		}
+	}
+
+	for _, c := range m.commands {
+		if param := c.reg.FindStringSubmatch(text); param != nil {
+			return c, param
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+)
+
+func recordCommand(name string, called *string) Command {
+	return func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		*called = name
+	}
+}
+
+func TestCommandRegistrationOrder(t *testing.T) {
+	m := New("", "")
+
+	var called string
+	if err := m.RegisterMentionCommand(`<@.+> build (\S+)`, recordCommand("build", &called)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RegisterMentionCommand(`<@.+> build (\S+) clean`, recordCommand("clean", &called)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多次执行, map遍历时结果是随机的
+	for i := 0; i < 20; i++ {
+		command, param := m.matchMentionCommand("<@B1> build ios clean")
+		command.process(context.Background(), nil, param)
+
+		if called != "build" {
+			t.Fatalf("expect first registered command, got %s", called)
+		}
+	}
+}
+
+func TestCommandPriority(t *testing.T) {
+	m := New("", "", WithStrictRouting())
+
+	var called string
+	m.RegisterMentionCommand(`<@.+> build (\S+)`, recordCommand("build", &called))
+	m.RegisterMentionCommand(`<@.+> build (\S+) clean`, recordCommand("clean", &called), Priority(1))
+
+	command, param := m.matchMentionCommand("<@B1> build ios clean")
+	command.process(context.Background(), nil, param)
+
+	if called != "clean" || param[1] != "ios" {
+		t.Errorf("expect high priority command, got %s %v", called, param)
+	}
+
+	if matched := m.MatchMentionCommands("<@B1> build ios clean"); len(matched) != 2 || matched[0] != `<@.+> build (\S+) clean` {
+		t.Errorf("unexpected matched: %v", matched)
+	}
+
+	if matched := m.MatchMentionCommands("<@B1> build ios"); len(matched) != 1 {
+		t.Errorf("unexpected matched: %v", matched)
+	}
+
+	if command, _ := m.matchMentionCommand("<@B1> ping"); command != nil {
+		t.Errorf("unexpected command: %s", command.pattern)
+	}
+}
+
+func TestCommandRegistrationError(t *testing.T) {
+	m := New("", "")
+
+	var called string
+	if err := m.RegisterMentionCommand(`<@.+> build (\S+`, recordCommand("build", &called)); err == nil {
+		t.Error("expect invalid regex error")
+	}
+
+	if err := m.RegisterMentionCommand(`<@.+> ping`, recordCommand("ping", &called)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RegisterMentionCommand(`<@.+> ping`, recordCommand("ping", &called)); err == nil {
+		t.Error("expect duplicate error")
+	}
+}
@@ -0,0 +1,235 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"io"
+	"sync"
+)
+
+// Context 命令和回调执行时的上下文, mention, slash command和交互回调都一样.
+// handler收到的ctx可以用FromContext拿到它, 不需要自己再创建slack client
+type Context struct {
+	context.Context
+
+	// Client Manager的slack client
+	Client *slack.Client
+	// Logger Manager的logger
+	Logger Logger
+
+	TeamID  string
+	Channel string
+	User    string
+	// ThreadTS 回复到thread时用的ts. 消息本身在thread里时是thread的ts, 否则是消息的ts
+	ThreadTS string
+	// Params 按pattern注册的回调从callback id或者action id里取出的参数, 比如 cancel_build:{build} 的build
+	Params map[string]string
+
+	// messageTS 触发这次执行的消息, slash command没有
+	messageTS   string
+	responseURL string
+
+	manager    *Manager
+	locale     string
+	localeOnce sync.Once
+}
+
+type contextKey struct{}
+
+// FromContext 在handler和中间件里拿到当前的Context, 不是在命令或者回调里执行时返回nil
+func FromContext(ctx context.Context) *Context {
+	c, _ := ctx.Value(contextKey{}).(*Context)
+	return c
+}
+
+func (c *Context) Value(key interface{}) interface{} {
+	if key == (contextKey{}) {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// Client 给handler以外的地方使用, 比如后台任务里发消息
+func (m *Manager) Client() *slack.Client {
+	return m.slackApi
+}
+
+func (m *Manager) newContext(ctx context.Context, req *Request) *Context {
+	c := &Context{
+		Context: ctx,
+		Client:  m.slackApi,
+		Logger:  m.logger,
+		manager: m,
+		TeamID:  req.TeamID,
+		Channel: req.Channel,
+		User:    req.User,
+		Params:  req.Params,
+	}
+
+	switch {
+	case req.Mention != nil:
+		c.messageTS = req.Mention.TimeStamp
+		c.ThreadTS = req.Mention.ThreadTimeStamp
+
+	case req.Slash != nil:
+		c.responseURL = req.Slash.ResponseURL
+
+	case req.Interaction != nil:
+		c.responseURL = req.Interaction.ResponseURL
+		c.messageTS = req.Interaction.Container.MessageTs
+		if c.messageTS == "" {
+			c.messageTS = req.Interaction.Message.Timestamp
+		}
+		c.ThreadTS = req.Interaction.Message.ThreadTimestamp
+
+	case req.Event != nil:
+		switch ev := req.Event.Data.(type) {
+		case *slackevents.MessageEvent:
+			c.messageTS = ev.TimeStamp
+			c.ThreadTS = ev.ThreadTimeStamp
+		case *slackevents.ReactionAddedEvent:
+			c.messageTS = ev.Item.Timestamp
+		case *slackevents.LinkSharedEvent:
+			c.messageTS = string(ev.MessageTimeStamp)
+			c.ThreadTS = ev.ThreadTimeStamp
+		}
+	}
+
+	if c.ThreadTS == "" {
+		c.ThreadTS = c.messageTS
+	}
+
+	return c
+}
+
+// Reply 在当前channel发消息
+func (c *Context) Reply(text string, options ...slack.MsgOption) error {
+	_, _, err := c.Client.PostMessageContext(c, c.Channel, append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)...)
+	return errors.Wrap(err, "回复消息失败")
+}
+
+// ReplyBlocks 截断超长的文字, 超过MaxMessageBlocks时分成多条消息. 先检查slack的限制, 不满足时一条都不发
+func (c *Context) ReplyBlocks(text string, blocks []slack.Block, options ...slack.MsgOption) error {
+	messages := SplitBlocks(TruncateBlocks(blocks), MaxMessageBlocks)
+	for _, message := range messages {
+		if err := ValidateBlocks(message); err != nil {
+			return err
+		}
+	}
+
+	for _, message := range messages {
+		if err := c.Reply(text, append([]slack.MsgOption{slack.MsgOptionBlocks(message...)}, options...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplyEphemeral 只回复给触发的人. 有response_url时用它, bot不在channel里也能回复
+func (c *Context) ReplyEphemeral(text string, options ...slack.MsgOption) error {
+	options = append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+
+	var err error
+	if c.responseURL != "" {
+		_, _, err = c.Client.PostMessageContext(c, c.Channel, append(options, slack.MsgOptionResponseURL(c.responseURL, slack.ResponseTypeEphemeral))...)
+	} else {
+		_, err = c.Client.PostEphemeralContext(c, c.Channel, c.User, options...)
+	}
+	return errors.Wrap(err, "回复消息失败")
+}
+
+// ReplyInThread 回复到触发消息的thread里. slash command没有消息, 直接发到channel
+func (c *Context) ReplyInThread(text string, options ...slack.MsgOption) error {
+	if c.ThreadTS != "" {
+		options = append(options, slack.MsgOptionTS(c.ThreadTS))
+	}
+	return c.Reply(text, options...)
+}
+
+// UpdateOriginal 修改触发交互回调的消息
+func (c *Context) UpdateOriginal(text string, options ...slack.MsgOption) error {
+	options = append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+
+	var err error
+	switch {
+	case c.responseURL != "":
+		_, _, err = c.Client.PostMessageContext(c, c.Channel, append(options, slack.MsgOptionReplaceOriginal(c.responseURL))...)
+	case c.messageTS != "":
+		_, _, _, err = c.Client.UpdateMessageContext(c, c.Channel, c.messageTS, options...)
+	default:
+		return errors.New("没有可以修改的消息")
+	}
+	return errors.Wrap(err, "修改消息失败")
+}
+
+// DeleteOriginal 删除触发交互回调的消息
+func (c *Context) DeleteOriginal() error {
+	var err error
+	switch {
+	case c.responseURL != "":
+		_, _, err = c.Client.PostMessageContext(c, c.Channel, slack.MsgOptionDeleteOriginal(c.responseURL))
+	case c.messageTS != "":
+		_, _, err = c.Client.DeleteMessageContext(c, c.Channel, c.messageTS)
+	default:
+		return errors.New("没有可以删除的消息")
+	}
+	return errors.Wrap(err, "删除消息失败")
+}
+
+// React 给触发的消息加emoji, name不带冒号
+func (c *Context) React(name string) error {
+	if c.messageTS == "" {
+		return errors.New("没有可以加reaction的消息")
+	}
+	return errors.Wrap(c.Client.AddReactionContext(c, name, slack.NewRefToMessage(c.Channel, c.messageTS)), "添加reaction失败")
+}
+
+// UploadFile 上传文件到当前channel, 在thread里触发时上传到thread
+func (c *Context) UploadFile(filename string, content io.Reader, comment string) (*slack.File, error) {
+	file, err := c.Client.UploadFileContext(c, slack.FileUploadParameters{
+		Reader:          content,
+		Filename:        filename,
+		InitialComment:  comment,
+		Channels:        []string{c.Channel},
+		ThreadTimestamp: c.threadOfMessage(),
+	})
+	return file, errors.Wrap(err, "上传文件失败")
+}
+
+// threadOfMessage 消息本身在thread里时才返回thread的ts
+func (c *Context) threadOfMessage() string {
+	if c.ThreadTS != c.messageTS {
+		return c.ThreadTS
+	}
+	return ""
+}
+
+// Locale 第一次调用时才确定用户的语言, 可能需要调用users.info
+func (c *Context) Locale() string {
+	c.localeOnce.Do(func() {
+		c.locale = c.manager.Locale(c, c.TeamID, c.User)
+	})
+	return c.locale
+}
+
+// T 按用户的语言翻译, 见Manager.T
+func (c *Context) T(format string, args ...interface{}) string {
+	return c.manager.T(c.Locale(), format, args...)
+}
+
+// ErrorText 按用户的语言翻译NewLocalizedError创建的错误
+func (c *Context) ErrorText(err error) string {
+	return c.manager.ErrorText(c.Locale(), err)
+}
+
+// NewBlockMessage 和NewBlockMessage一样, template里的T按用户的语言翻译
+func (c *Context) NewBlockMessage(block string, params interface{}) (*slack.Blocks, error) {
+	return newBlockMessage(block, params, c.T)
+}
+
+// NewModalView 和NewModalView一样, title, submit和template里的T按用户的语言翻译
+func (c *Context) NewModalView(callbackID, title, submit, block string, params interface{}) (*slack.ModalViewRequest, error) {
+	return newModalView(callbackID, title, submit, block, params, c.T)
+}
@@ -0,0 +1,182 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSlackAPI 记录收到的web api和response_url请求. users.info返回locale
+type fakeSlackAPI struct {
+	*httptest.Server
+
+	// locale 在发请求之前设置
+	locale string
+
+	lock  sync.Mutex
+	calls []string
+	texts []string
+}
+
+func newFakeSlackAPI() *fakeSlackAPI {
+	f := &fakeSlackAPI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		call, text := r.URL.Path, ""
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var msg map[string]interface{}
+			json.Unmarshal(body, &msg)
+			text, _ = msg["text"].(string)
+			for _, key := range []string{"response_type", "replace_original", "delete_original"} {
+				if v, has := msg[key]; has && v != false {
+					call += " " + key + "=" + fmt.Sprint(v)
+				}
+			}
+		} else {
+			form, _ := url.ParseQuery(string(body))
+			text = form.Get("text")
+			for _, key := range []string{"channel", "user", "thread_ts", "ts", "timestamp", "name"} {
+				if v := form.Get(key); v != "" {
+					call += " " + key + "=" + v
+				}
+			}
+		}
+
+		f.lock.Lock()
+		f.calls = append(f.calls, call)
+		if r.URL.Path != "/users.info" {
+			f.texts = append(f.texts, text)
+		}
+		f.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/users.info" {
+			w.Write([]byte(`{"ok":true,"user":{"id":"U1","locale":"` + f.locale + `"}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0"}`))
+	}))
+	return f
+}
+
+func (f *fakeSlackAPI) takeCalls() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// takeTexts 发出去的消息的text, 不包括users.info
+func (f *fakeSlackAPI) takeTexts() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	texts := f.texts
+	f.texts = nil
+	return texts
+}
+
+// countCalls path开头的请求数量, 不会清空
+func (f *fakeSlackAPI) countCalls(path string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	n := 0
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, path) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestContextMention(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	var errs []error
+	m.RegisterMentionCommand(`^<@.+> ping`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		c := FromContext(ctx)
+		errs = append(errs, c.Reply("pong"), c.ReplyInThread("pong"), c.ReplyEphemeral("pong"), c.React("eyes"), c.UpdateOriginal("pong"))
+	})
+
+	command, param := m.matchMentionCommand("<@B1> ping")
+	ev := &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: "<@B1> ping", TimeStamp: "2.0"}
+	m.execute(context.Background(), mentionRequest(ev, command), nil, func(ctx context.Context) {
+		command.process(ctx, ev, param)
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	expect := []string{
+		"/chat.postMessage channel=C1",
+		"/chat.postMessage channel=C1 thread_ts=2.0",
+		"/chat.postEphemeral channel=C1 user=U1",
+		"/reactions.add channel=C1 timestamp=2.0 name=eyes",
+		"/chat.update channel=C1 ts=2.0",
+	}
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
+
+func TestContextInteraction(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	var errs []error
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		c := FromContext(ctx)
+		errs = append(errs, c.ReplyEphemeral("ok"))
+		if err := c.React("eyes"); err == nil {
+			errs = append(errs, errors.New("slash command没有消息, 不能加reaction"))
+		}
+	})
+
+	m.RegisterBlockCallback("cancel", func(ctx context.Context, action *slack.BlockAction, callback slack.InteractionCallback) {
+		c := FromContext(ctx)
+		errs = append(errs, c.UpdateOriginal("已取消"), c.DeleteOriginal())
+	})
+
+	m.dispatchSlashCommand(context.Background(), &slack.SlashCommand{Command: "/ucb", ChannelID: "C1", UserID: "U1", ResponseURL: api.URL + "/respond"})
+
+	var action slack.InteractionCallback
+	json.Unmarshal([]byte(`{"type":"block_actions","response_url":"`+api.URL+`/respond","channel":{"id":"C1"},"user":{"id":"U1"},
+		"container":{"type":"message","message_ts":"3.0"},
+		"actions":[{"action_id":"cancel","block_id":"b"}]}`), &action)
+	m.dispatchInteraction(context.Background(), action)
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	expect := []string{
+		"/respond response_type=ephemeral",
+		"/respond replace_original=true",
+		"/respond delete_original=true",
+	}
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
@@ -0,0 +1,173 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chentmin/once"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate DedupStore已经见过这个key
+var ErrDuplicate = errors.New("重复的事件")
+
+// DedupStore 记录处理过的事件. slack没有及时收到回复会重试, 同一个事件可能收到多次
+type DedupStore interface {
+	// Ensure 第一次见到key时返回nil, 见过时返回ErrDuplicate
+	Ensure(ctx context.Context, key string) error
+}
+
+// WithDedupStore 设置去重用的store. 事件按event_id去重, 交互回调按trigger_id去重
+func WithDedupStore(store DedupStore) option {
+	return func(manager *Manager) {
+		manager.dedup = store
+	}
+}
+
+// OnlyOnceByDynamoDB 用DynamoDB去重, 多个lambda实例之间也能去重
+func OnlyOnceByDynamoDB(table string) option {
+	return WithDedupStore(NewDynamoDedupStore(table))
+}
+
+// ensureOnce key为空时不去重. store出错时只打印, 宁可重复执行也不丢掉事件
+func (m *Manager) ensureOnce(ctx context.Context, key string) bool {
+	if m.dedup == nil || key == "" {
+		return true
+	}
+
+	err := m.dedup.Ensure(ctx, key)
+	if err == ErrDuplicate {
+		m.logger.Info("忽略重复的事件", Fields{"key": key})
+		return false
+	}
+	if err != nil {
+		m.logger.Error("去重失败", Fields{"key": key, "error": err})
+	}
+	return true
+}
+
+// slackRetry 解析X-Slack-Retry-Num和X-Slack-Retry-Reason, 不是重试时num为0
+func slackRetry(r *http.Request) (num int, reason string) {
+	num, _ = strconv.Atoi(r.Header.Get("X-Slack-Retry-Num"))
+	return num, r.Header.Get("X-Slack-Retry-Reason")
+}
+
+type memoryDedupStore struct {
+	sync.Mutex
+
+	ttl    time.Duration
+	seen   map[string]time.Time
+	purged time.Time
+}
+
+// NewMemoryDedupStore 进程内的去重, 适合本地运行和测试. key在ttl之后过期
+func NewMemoryDedupStore(ttl time.Duration) DedupStore {
+	return &memoryDedupStore{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryDedupStore) Ensure(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.purged) > s.ttl {
+		purgeExpired(s.seen, now)
+		s.purged = now
+	}
+
+	if expire, has := s.seen[key]; has && now.Before(expire) {
+		return ErrDuplicate
+	}
+
+	s.seen[key] = now.Add(s.ttl)
+	return nil
+}
+
+func purgeExpired(seen map[string]time.Time, now time.Time) {
+	for key, expire := range seen {
+		if !now.Before(expire) {
+			delete(seen, key)
+		}
+	}
+}
+
+type fileDedupStore struct {
+	sync.Mutex
+
+	path string
+	ttl  time.Duration
+	seen map[string]time.Time
+}
+
+// NewFileDedupStore 把见过的key存在本地json文件里, 本地运行重启之后也能去重
+func NewFileDedupStore(path string, ttl time.Duration) (DedupStore, error) {
+	result := &fileDedupStore{
+		path: path,
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "读取去重文件失败")
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &result.seen); err != nil {
+			return nil, errors.Wrap(err, "解析去重文件失败")
+		}
+	}
+
+	return result, nil
+}
+
+func (s *fileDedupStore) Ensure(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	purgeExpired(s.seen, now)
+
+	if _, has := s.seen[key]; has {
+		return ErrDuplicate
+	}
+
+	s.seen[key] = now.Add(s.ttl)
+
+	data, err := json.Marshal(s.seen)
+	if err != nil {
+		return errors.Wrap(err, "序列化去重记录失败")
+	}
+
+	// 先写临时文件再rename, 中途退出不会留下写了一半的文件
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "写去重文件失败")
+	}
+	return errors.Wrap(os.Rename(tmp, s.path), "写去重文件失败")
+}
+
+type dynamoDedupStore struct {
+	table string
+}
+
+// NewDynamoDedupStore 用DynamoDB的条件写入去重, table的主键是字符串id
+func NewDynamoDedupStore(table string) DedupStore {
+	return &dynamoDedupStore{table: table}
+}
+
+func (s *dynamoDedupStore) Ensure(ctx context.Context, key string) error {
+	err := once.New(s.table).Ensure(key)
+	if err == once.DuplicateErr {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	store := NewMemoryDedupStore(50 * time.Millisecond)
+	ctx := context.Background()
+
+	if err := store.Ensure(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ensure(ctx, "a"); err != ErrDuplicate {
+		t.Errorf("expect duplicate, got %v", err)
+	}
+	if err := store.Ensure(ctx, "b"); err != nil {
+		t.Errorf("different key: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if err := store.Ensure(ctx, "a"); err != nil {
+		t.Errorf("key should expire: %v", err)
+	}
+}
+
+func TestFileDedupStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dedup.json")
+	ctx := context.Background()
+
+	store, err := NewFileDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ensure(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后还记得见过的key
+	store, err = NewFileDedupStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ensure(ctx, "a"); err != ErrDuplicate {
+		t.Errorf("expect duplicate after reopen, got %v", err)
+	}
+}
+
+func TestDedupEvents(t *testing.T) {
+	m := New("", "", WithSigningSecret("secret"), WithDedupStore(NewMemoryDedupStore(time.Hour)))
+
+	called := 0
+	m.RegisterMentionCommand(`^<@.+> ping`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		called++
+	})
+
+	r := m.Handler()
+
+	post := func(eventID, ts string, header map[string]string) {
+		body := `{"type":"event_callback","event_id":"` + eventID + `","event":{"type":"app_mention","user":"U1","channel":"C1","ts":"` + ts + `","text":"<@B1> ping"}}`
+
+		req := httptest.NewRequest(http.MethodPost, "/message", strings.NewReader(body))
+		signRequest(req, "secret", body, time.Now())
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("status: %d", w.Code)
+		}
+	}
+
+	post("Ev1", "1.0", nil)
+	post("Ev1", "1.0", map[string]string{"X-Slack-Retry-Num": "1", "X-Slack-Retry-Reason": "http_error"})
+	post("Ev1", "1.0", map[string]string{"X-Slack-Retry-Num": "2", "X-Slack-Retry-Reason": "http_timeout"})
+
+	if called != 1 {
+		t.Errorf("retries should be ignored, called %d times", called)
+	}
+
+	// 另一个channel里ts相同的消息是不同的事件
+	post("Ev2", "1.0", nil)
+
+	if called != 2 {
+		t.Errorf("different event id should be processed, called %d times", called)
+	}
+}
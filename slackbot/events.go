@@ -0,0 +1,297 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack/slackevents"
+	"sync"
+)
+
+// Event Events API里的一个事件. Data是slackevents解析出的结构, 比如*slackevents.MessageEvent.
+// slackevents不认识的类型Data为nil, 用Decode从原始json解析
+type Event struct {
+	Type    string
+	TeamID  string
+	EventID string
+	Data    interface{}
+	Raw     json.RawMessage
+}
+
+// Decode 把原始json解析到v里
+func (e *Event) Decode(v interface{}) error {
+	return errors.Wrapf(json.Unmarshal(e.Raw, v), "解析%s事件失败", e.Type)
+}
+
+// unexpectedData Data不是这个类型对应的结构, 正常不会出现, parseEvent解析失败的事件不会分发
+func (e *Event) unexpectedData() error {
+	return errors.Errorf("%s事件的数据类型不对: %T", e.Type, e.Data)
+}
+
+type EventHandler func(ctx context.Context, event *Event)
+
+type MessageHandler func(ctx context.Context, ev *slackevents.MessageEvent)
+
+type ReactionAddedHandler func(ctx context.Context, ev *slackevents.ReactionAddedEvent)
+
+type MemberJoinedChannelHandler func(ctx context.Context, ev *slackevents.MemberJoinedChannelEvent)
+
+type AppHomeOpenedHandler func(ctx context.Context, ev *slackevents.AppHomeOpenedEvent)
+
+type LinkSharedHandler func(ctx context.Context, ev *slackevents.LinkSharedEvent)
+
+type FileSharedHandler func(ctx context.Context, ev *FileSharedEvent)
+
+// FileSharedEvent slackevents里没有Events API的file_shared
+type FileSharedEvent struct {
+	Type           string `json:"type"`
+	FileID         string `json:"file_id"`
+	UserID         string `json:"user_id"`
+	ChannelID      string `json:"channel_id"`
+	EventTimestamp string `json:"event_ts"`
+}
+
+type eventHandler struct {
+	registration
+
+	eventType string
+	handler   EventHandler
+}
+
+// IncludeBots 默认不处理bot发的消息和bot自己加的reaction, 以免bot之间互相回复停不下来. 只对事件有效
+func IncludeBots() registerOption {
+	return func(r *registration) {
+		r.includeBots = true
+	}
+}
+
+// RegisterEventHandler eventType是Events API的inner event类型, 比如 message, reaction_added.
+// 同一个类型可以注册多个handler, 按注册顺序都会执行. slack app里还需要订阅这个事件
+func (m *Manager) RegisterEventHandler(eventType string, handler EventHandler, options ...registerOption) {
+	h := &eventHandler{eventType: eventType, handler: handler}
+	for _, ops := range options {
+		ops(&h.registration)
+	}
+	m.eventHandlers = append(m.eventHandlers, h)
+}
+
+// RegisterMessageHandler 包括所有subtype的消息, 比如message_changed, 需要的话自己判断ev.SubType
+func (m *Manager) RegisterMessageHandler(handler MessageHandler, options ...registerOption) {
+	m.RegisterEventHandler(slackevents.Message, func(ctx context.Context, event *Event) {
+		ev, ok := event.Data.(*slackevents.MessageEvent)
+		if !ok {
+			ReportError(ctx, event.unexpectedData())
+			return
+		}
+		handler(ctx, ev)
+	}, options...)
+}
+
+func (m *Manager) RegisterReactionAddedHandler(handler ReactionAddedHandler, options ...registerOption) {
+	m.RegisterEventHandler(slackevents.ReactionAdded, func(ctx context.Context, event *Event) {
+		ev, ok := event.Data.(*slackevents.ReactionAddedEvent)
+		if !ok {
+			ReportError(ctx, event.unexpectedData())
+			return
+		}
+		handler(ctx, ev)
+	}, options...)
+}
+
+func (m *Manager) RegisterMemberJoinedChannelHandler(handler MemberJoinedChannelHandler, options ...registerOption) {
+	m.RegisterEventHandler(slackevents.MemberJoinedChannel, func(ctx context.Context, event *Event) {
+		ev, ok := event.Data.(*slackevents.MemberJoinedChannelEvent)
+		if !ok {
+			ReportError(ctx, event.unexpectedData())
+			return
+		}
+		handler(ctx, ev)
+	}, options...)
+}
+
+// RegisterAppHomeOpenedHandler ev.Tab是home或者messages
+func (m *Manager) RegisterAppHomeOpenedHandler(handler AppHomeOpenedHandler, options ...registerOption) {
+	m.RegisterEventHandler(slackevents.AppHomeOpened, func(ctx context.Context, event *Event) {
+		ev, ok := event.Data.(*slackevents.AppHomeOpenedEvent)
+		if !ok {
+			ReportError(ctx, event.unexpectedData())
+			return
+		}
+		handler(ctx, ev)
+	}, options...)
+}
+
+// RegisterLinkSharedHandler 只有slack app里设置过的域名才会收到, 用来做link unfurl
+func (m *Manager) RegisterLinkSharedHandler(handler LinkSharedHandler, options ...registerOption) {
+	m.RegisterEventHandler(slackevents.LinkShared, func(ctx context.Context, event *Event) {
+		ev, ok := event.Data.(*slackevents.LinkSharedEvent)
+		if !ok {
+			ReportError(ctx, event.unexpectedData())
+			return
+		}
+		handler(ctx, ev)
+	}, options...)
+}
+
+func (m *Manager) RegisterFileSharedHandler(handler FileSharedHandler, options ...registerOption) {
+	m.RegisterEventHandler("file_shared", func(ctx context.Context, event *Event) {
+		var ev FileSharedEvent
+		if err := event.Decode(&ev); err != nil {
+			ReportError(ctx, err)
+			return
+		}
+		handler(ctx, &ev)
+	}, options...)
+}
+
+// eventDecodeError token校验过了, 但是slackevents认识的类型解析失败. 重试也一样会失败, 记录下来直接回复200
+type eventDecodeError struct {
+	error
+}
+
+func (e *eventDecodeError) Unwrap() error { return e.error }
+
+// parseEvent slackevents不认识的inner event类型会解析失败, 这时只解析外层, InnerEvent.Data为nil.
+// 认识的类型解析失败时返回eventDecodeError, 不能当成不认识的类型分发.
+// verifyToken为false时不检查verification token, 比如socket mode
+func (m *Manager) parseEvent(body json.RawMessage, verifyToken bool) (slackevents.EventsAPIEvent, error) {
+	verifyOption := slackevents.OptionNoVerifyToken()
+	if verifyToken && m.signingSecret == "" {
+		verifyOption = slackevents.OptionVerifyToken(slackevents.TokenComparator{VerificationToken: m.slackVerificationToken})
+	}
+
+	eventsAPIEvent, err := slackevents.ParseEvent(body, verifyOption)
+	if err == nil {
+		return eventsAPIEvent, nil
+	}
+
+	var cb slackevents.EventsAPICallbackEvent
+	if json.Unmarshal(body, &cb) != nil || cb.Type != slackevents.CallbackEvent || cb.InnerEvent == nil {
+		return eventsAPIEvent, err
+	}
+	if verifyToken && !m.verifyToken(cb.Token) {
+		return eventsAPIEvent, err
+	}
+
+	var inner struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(*cb.InnerEvent, &inner) != nil || inner.Type == "" {
+		return eventsAPIEvent, err
+	}
+	if _, known := slackevents.EventsAPIInnerEventMapping[inner.Type]; known {
+		return eventsAPIEvent, &eventDecodeError{errors.Wrapf(err, "解析%s事件失败", inner.Type)}
+	}
+
+	return slackevents.EventsAPIEvent{
+		Token:      cb.Token,
+		TeamID:     cb.TeamID,
+		Type:       cb.Type,
+		APIAppID:   cb.APIAppID,
+		Data:       &cb,
+		InnerEvent: slackevents.EventsAPIInnerEvent{Type: inner.Type},
+	}, nil
+}
+
+// dispatchEventHandlers 执行这个类型的所有handler, 没有handler时返回false
+func (m *Manager) dispatchEventHandlers(ctx context.Context, eventsAPIEvent slackevents.EventsAPIEvent, eventID string) bool {
+	event := &Event{
+		Type:    eventsAPIEvent.InnerEvent.Type,
+		TeamID:  eventsAPIEvent.TeamID,
+		EventID: eventID,
+		Data:    eventsAPIEvent.InnerEvent.Data,
+	}
+	if cb, ok := eventsAPIEvent.Data.(*slackevents.EventsAPICallbackEvent); ok && cb.InnerEvent != nil {
+		event.Raw = *cb.InnerEvent
+	}
+
+	found := false
+	for _, h := range m.eventHandlers {
+		if h.eventType != event.Type {
+			continue
+		}
+		found = true
+
+		if !h.includeBots && m.isBotEvent(ctx, event) {
+			continue
+		}
+
+		h := h // 可能在后台执行
+		m.schedule(ctx, m.eventRequest(event), &h.registration, func(ctx context.Context) {
+			h.handler(ctx, event)
+		})
+	}
+	return found
+}
+
+func (m *Manager) eventRequest(event *Event) *Request {
+	req := &Request{
+		Kind:    KindEvent,
+		ID:      event.Type,
+		Name:    event.Type,
+		EventID: event.EventID,
+		TeamID:  event.TeamID,
+		Event:   event,
+	}
+
+	switch ev := event.Data.(type) {
+	case *slackevents.MessageEvent:
+		req.Channel, req.User, req.Text = ev.Channel, ev.User, ev.Text
+	case *slackevents.ReactionAddedEvent:
+		req.Channel, req.User = ev.Item.Channel, ev.User
+	case *slackevents.MemberJoinedChannelEvent:
+		req.Channel, req.User = ev.Channel, ev.User
+	case *slackevents.AppHomeOpenedEvent:
+		req.Channel, req.User = ev.Channel, ev.User
+	case *slackevents.LinkSharedEvent:
+		req.Channel, req.User = ev.Channel, ev.User
+	default:
+		if event.Type == "file_shared" {
+			var ev FileSharedEvent
+			if err := event.Decode(&ev); err != nil {
+				m.logger.Warn("解析事件失败", Fields{"event_id": event.EventID, "team": event.TeamID, "type": event.Type, "error": err})
+				break
+			}
+			req.Channel, req.User = ev.ChannelID, ev.UserID
+		}
+	}
+	return req
+}
+
+// isBotEvent bot发的消息和mention, 或者bot自己加的reaction
+func (m *Manager) isBotEvent(ctx context.Context, event *Event) bool {
+	switch ev := event.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		return ev.BotID != ""
+	case *slackevents.MessageEvent:
+		if ev.BotID != "" || ev.SubType == "bot_message" {
+			return true
+		}
+		// message_changed之类的subtype, 消息内容在ev.Message里
+		return ev.Message != nil && ev.Message.BotID != ""
+	case *slackevents.ReactionAddedEvent:
+		return ev.User != "" && ev.User == m.botUserID(ctx)
+	}
+	return false
+}
+
+type botUserCache struct {
+	lock   sync.Mutex
+	userID string
+}
+
+// botUserID bot自己的user id, 失败时返回空, 下次再试
+func (m *Manager) botUserID(ctx context.Context) string {
+	m.botUser.lock.Lock()
+	defer m.botUser.lock.Unlock()
+
+	if m.botUser.userID == "" {
+		resp, err := m.slackApi.AuthTestContext(ctx)
+		if err != nil {
+			m.logger.Warn("获取bot的user id失败", Fields{"error": err})
+			return ""
+		}
+		m.botUser.userID = resp.UserID
+	}
+	return m.botUser.userID
+}
@@ -0,0 +1,163 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func postEvent(m *Manager, token, event string) int {
+	body := `{"type":"event_callback","token":"` + token + `","team_id":"T1","event":` + event + `}`
+	req := httptest.NewRequest(http.MethodPost, "/message", strings.NewReader(body))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestEventHandlers(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "verify", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	var calls []string
+	m.RegisterMessageHandler(func(ctx context.Context, ev *slackevents.MessageEvent) {
+		c := FromContext(ctx)
+		calls = append(calls, "message "+ev.Text)
+		c.React("eyes")
+	})
+	m.RegisterMessageHandler(func(ctx context.Context, ev *slackevents.MessageEvent) {
+		calls = append(calls, "bots "+ev.Text)
+	}, IncludeBots())
+	m.RegisterReactionAddedHandler(func(ctx context.Context, ev *slackevents.ReactionAddedEvent) {
+		calls = append(calls, "reaction "+ev.Reaction+" "+FromContext(ctx).Channel)
+	})
+	m.RegisterFileSharedHandler(func(ctx context.Context, ev *FileSharedEvent) {
+		calls = append(calls, "file "+ev.FileID+" "+FromContext(ctx).User)
+	})
+	m.RegisterEventHandler("team_join", func(ctx context.Context, event *Event) {
+		var ev struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		}
+		event.Decode(&ev)
+		calls = append(calls, "raw "+event.Type+" "+ev.User.ID)
+	})
+
+	events := []string{
+		`{"type":"message","user":"U1","channel":"C1","ts":"1.0","text":"hi"}`,
+		`{"type":"message","bot_id":"B1","subtype":"bot_message","channel":"C1","ts":"2.0","text":"from bot"}`,
+		`{"type":"reaction_added","user":"U1","reaction":"tada","item":{"type":"message","channel":"C1","ts":"1.0"}}`,
+		`{"type":"file_shared","file_id":"F1","user_id":"U1","channel_id":"C1","file":{"id":"F1"}}`,
+		`{"type":"team_join","user":{"id":"U2"}}`,
+	}
+	for _, event := range events {
+		if code := postEvent(m, "verify", event); code != http.StatusOK {
+			t.Errorf("%s: status %d", event, code)
+		}
+	}
+
+	expect := []string{
+		"message hi",
+		"bots hi",
+		"bots from bot",
+		"reaction tada C1",
+		"file F1 U1",
+		"raw team_join U2",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, []string{"/reactions.add channel=C1 timestamp=1.0 name=eyes", "/auth.test"}) {
+		t.Errorf("unexpected api calls: %q", calls)
+	}
+
+	// 不认识的事件类型也要校验token
+	if code := postEvent(m, "wrong", `{"type":"team_join","user":{"id":"U3"}}`); code != http.StatusBadRequest {
+		t.Errorf("wrong token: status %d", code)
+	}
+}
+
+func TestEventHandlersSkipOwnReaction(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "verify", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+	// fakeSlackAPI的auth.test没有user_id, 直接设置
+	m.botUser.userID = "UBOT"
+
+	var reactions []string
+	m.RegisterReactionAddedHandler(func(ctx context.Context, ev *slackevents.ReactionAddedEvent) {
+		reactions = append(reactions, ev.User)
+	})
+
+	postEvent(m, "verify", `{"type":"reaction_added","user":"UBOT","reaction":"eyes","item":{"type":"message","channel":"C1","ts":"1.0"}}`)
+	postEvent(m, "verify", `{"type":"reaction_added","user":"U1","reaction":"eyes","item":{"type":"message","channel":"C1","ts":"1.0"}}`)
+
+	if !reflect.DeepEqual(reactions, []string{"U1"}) {
+		t.Errorf("unexpected reactions: %q", reactions)
+	}
+}
+
+func TestEventRequestDecodeError(t *testing.T) {
+	logger := &recordLogger{}
+	m := New("", "verify", WithLogger(logger))
+
+	var users []string
+	m.RegisterEventHandler("file_shared", func(ctx context.Context, event *Event) {
+		users = append(users, RequestFromContext(ctx).User)
+	})
+
+	postEvent(m, "verify", `{"type":"file_shared","file_id":"F1","user_id":1,"channel_id":"C1"}`)
+
+	if !reflect.DeepEqual(users, []string{""}) {
+		t.Errorf("unexpected users: %q", users)
+	}
+
+	warned := false
+	for i, entry := range logger.entries {
+		if entry == "warn 解析事件失败" {
+			warned = logger.fields[i]["type"] == "file_shared"
+		}
+	}
+	if !warned {
+		t.Errorf("decode error not logged: %q", logger.entries)
+	}
+}
+
+func TestEventDecodeErrorIsAcked(t *testing.T) {
+	m := New("", "verify")
+
+	var calls []string
+	m.RegisterMessageHandler(func(ctx context.Context, ev *slackevents.MessageEvent) {
+		calls = append(calls, ev.Text)
+	})
+	m.RegisterMentionCommand(`<@.+> ping`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		calls = append(calls, ev.Text)
+	})
+
+	// 认识的类型解析失败时不能当成不认识的类型分发, 重试也没用, 回复200
+	for _, event := range []string{
+		`{"type":"message","user":"U1","channel":"C1","ts":"1.0","text":"hi","files":"oops"}`,
+		`{"type":"app_mention","user":1,"channel":"C1","ts":"2.0","text":"<@B1> ping"}`,
+	} {
+		if code := postEvent(m, "verify", event); code != http.StatusOK {
+			t.Errorf("%s: status %d", event, code)
+		}
+	}
+	if code := postEvent(m, "wrong", `{"type":"message","user":"U1","files":"oops"}`); code != http.StatusBadRequest {
+		t.Errorf("wrong token: status %d", code)
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("undecodable events should not be dispatched: %q", calls)
+	}
+}
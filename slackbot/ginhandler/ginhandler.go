@@ -0,0 +1,26 @@
+// Package ginhandler 把Manager的http handler注册到gin
+package ginhandler
+
+import (
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/gin-gonic/gin"
+)
+
+// Register 注册POST /message, /interact和/command
+func Register(r gin.IRoutes, m *slackbot.Manager) {
+	r.POST("/message", MessageEvent(m))
+	r.POST("/interact", CallbackEvent(m))
+	r.POST("/command", SlashCommand(m))
+}
+
+func MessageEvent(m *slackbot.Manager) gin.HandlerFunc {
+	return gin.WrapF(m.ServeMessageEvent)
+}
+
+func CallbackEvent(m *slackbot.Manager) gin.HandlerFunc {
+	return gin.WrapF(m.ServeCallbackEvent)
+}
+
+func SlashCommand(m *slackbot.Manager) gin.HandlerFunc {
+	return gin.WrapF(m.ServeSlashCommand)
+}
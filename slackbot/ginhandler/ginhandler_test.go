@@ -0,0 +1,37 @@
+package ginhandler
+
+import (
+	"context"
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := slackbot.New("", "verify")
+
+	called := false
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		called = true
+	})
+
+	r := gin.New()
+	Register(r, m)
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(url.Values{"token": {"verify"}, "command": {"/ucb"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !called {
+		t.Errorf("status: %d called: %v", w.Code, called)
+	}
+}
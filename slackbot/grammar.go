@@ -0,0 +1,344 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"gopkg.in/go-playground/validator.v9"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ArgsCommand 收到的args是CommandSpec.Args同类型的指针, 已经绑定好参数并通过校验
+type ArgsCommand func(ctx context.Context, ev *slackevents.AppMentionEvent, args interface{})
+
+// CommandSpec 声明式的命令. Args是一个struct, 字段用tag声明参数:
+//
+//	type buildArgs struct {
+//		Target string `arg:"target" desc:"构建目标" validate:"required"`
+//		Clean  bool   `flag:"clean" desc:"clean build"`
+//		Commit string `flag:"commit" desc:"指定commit" validate:"omitempty,hexadecimal"`
+//	}
+//
+// arg按字段顺序对应位置参数. bool的flag写成--clean或者clean, 其它flag写成--commit=abc或者commit=abc.
+// validate的规则见validator.v9
+type CommandSpec struct {
+	Name        string
+	Description string
+	Args        interface{}
+}
+
+type argSpec struct {
+	name        string
+	description string
+	field       int
+	flag        bool
+	optional    bool
+}
+
+type commandSpec struct {
+	CommandSpec
+
+	argsType reflect.Type
+	args     []*argSpec
+	flags    map[string]*argSpec
+	flagList []*argSpec
+}
+
+var (
+	mentionPrefix = regexp.MustCompile(`^<@[^>]+>\s*`)
+
+	argsValidator = newArgsValidator()
+)
+
+func newArgsValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		if name := field.Tag.Get("arg"); name != "" {
+			return name
+		}
+		return field.Tag.Get("flag")
+	})
+	return v
+}
+
+func newCommandSpec(spec CommandSpec) (*commandSpec, error) {
+	if strings.TrimSpace(spec.Name) == "" {
+		return nil, errors.New("command没有名字")
+	}
+
+	result := &commandSpec{
+		CommandSpec: spec,
+		flags:       make(map[string]*argSpec),
+	}
+
+	if spec.Args == nil {
+		return result, nil
+	}
+
+	t := reflect.TypeOf(spec.Args)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("command %s的Args必须是struct: %s", spec.Name, t)
+	}
+	result.argsType = t
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		arg := &argSpec{
+			description: field.Tag.Get("desc"),
+			field:       i,
+			optional:    !strings.Contains(field.Tag.Get("validate"), "required"),
+		}
+
+		if arg.name = field.Tag.Get("arg"); arg.name != "" {
+			if err := checkArgKind(field); err != nil {
+				return nil, err
+			}
+			result.args = append(result.args, arg)
+			continue
+		}
+
+		if arg.name = field.Tag.Get("flag"); arg.name != "" {
+			if err := checkArgKind(field); err != nil {
+				return nil, err
+			}
+			if _, has := result.flags[arg.name]; has {
+				return nil, errors.Errorf("command %s的flag重复: %s", spec.Name, arg.name)
+			}
+			arg.flag = field.Type.Kind() == reflect.Bool
+			result.flags[arg.name] = arg
+			result.flagList = append(result.flagList, arg)
+		}
+	}
+
+	return result, nil
+}
+
+func checkArgKind(field reflect.StructField) error {
+	switch field.Type.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+	}
+	return errors.Errorf("不支持的参数类型: %s %s", field.Name, field.Type)
+}
+
+// pattern 只匹配命令名, 参数交给parse处理
+func (s *commandSpec) pattern() string {
+	words := strings.Fields(s.Name)
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return `^<@[^>]+>\s+` + strings.Join(words, `\s+`) + `(\s|$)`
+}
+
+// Usage 形如 build <target> [--clean] [--commit=<commit>]
+func (s *commandSpec) Usage() string {
+	parts := []string{s.Name}
+
+	for _, arg := range s.args {
+		if arg.optional {
+			parts = append(parts, "["+arg.name+"]")
+		} else {
+			parts = append(parts, "<"+arg.name+">")
+		}
+	}
+
+	for _, flag := range s.flagList {
+		if flag.flag {
+			parts = append(parts, "[--"+flag.name+"]")
+		} else {
+			parts = append(parts, "[--"+flag.name+"=<"+flag.name+">]")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// parse 把消息解析成Args的新实例并校验. 返回的是指针
+func (s *commandSpec) parse(text string) (interface{}, error) {
+	words := strings.Fields(mentionPrefix.ReplaceAllString(strings.TrimSpace(text), ""))
+	words = words[len(strings.Fields(s.Name)):]
+
+	if s.argsType == nil {
+		if len(words) > 0 {
+			return nil, NewLocalizedError("多余的参数: %s", strings.Join(words, " "))
+		}
+		return nil, nil
+	}
+
+	value := reflect.New(s.argsType)
+	positional := 0
+
+	for _, word := range words {
+		name, v, isFlag := s.splitFlag(word)
+		if isFlag {
+			flag, has := s.flags[name]
+			if !has {
+				return nil, NewLocalizedError("未知的参数: %s", word)
+			}
+			if err := setField(value.Elem().Field(flag.field), v); err != nil {
+				return nil, NewLocalizedError("参数%s: %s", flag.name, err)
+			}
+			continue
+		}
+
+		if positional >= len(s.args) {
+			return nil, NewLocalizedError("多余的参数: %s", word)
+		}
+
+		arg := s.args[positional]
+		if err := setField(value.Elem().Field(arg.field), word); err != nil {
+			return nil, NewLocalizedError("参数%s: %s", arg.name, err)
+		}
+		positional++
+	}
+
+	if err := argsValidator.Struct(value.Interface()); err != nil {
+		if errs, ok := err.(validator.ValidationErrors); ok {
+			var result localizedErrors
+			for _, e := range errs {
+				result = append(result, NewLocalizedError("参数%s不满足%s", e.Field(), e.Tag()))
+			}
+			return nil, result
+		}
+		return nil, errors.Wrap(err, "参数校验失败")
+	}
+
+	return value.Interface(), nil
+}
+
+// matches text去掉mention之后是不是以命令名开头
+func (s *commandSpec) matches(text string) bool {
+	words := strings.Fields(mentionPrefix.ReplaceAllString(strings.TrimSpace(text), ""))
+	name := strings.Fields(s.Name)
+	if len(words) < len(name) {
+		return false
+	}
+	for i, w := range name {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// usageError 参数错误后面带上用法, 回复给用户时按用户的语言翻译
+func (s *commandSpec) usageError(err error) error {
+	return NewLocalizedError("%s\n用法: %s", err, s.Usage())
+}
+
+// ParseCommand 用RegisterCommand同一个spec解析不经过mention的文本, 比如 /ucb build ios --clean 的 build ios --clean,
+// 两个入口的参数和校验保持一致. 参数不合法时返回的错误带上用法, 用ErrorText回复给用户
+func ParseCommand(spec CommandSpec, text string) (interface{}, error) {
+	parsed, err := newCommandSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if !parsed.matches(text) {
+		return nil, parsed.usageError(NewLocalizedError("收到未知的命令: %s", text))
+	}
+
+	args, err := parsed.parse(text)
+	if err != nil {
+		return nil, parsed.usageError(err)
+	}
+	return args, nil
+}
+
+// splitFlag 识别 --clean, --commit=abc, commit=abc 和 clean 这几种写法
+func (s *commandSpec) splitFlag(word string) (name, value string, isFlag bool) {
+	trimmed := strings.TrimPrefix(word, "--")
+	dashed := trimmed != word
+
+	if i := strings.Index(trimmed, "="); i > 0 {
+		name, value = trimmed[:i], trimmed[i+1:]
+		if _, has := s.flags[name]; has || dashed {
+			return name, value, true
+		}
+		return "", "", false
+	}
+
+	if flag, has := s.flags[trimmed]; has && flag.flag {
+		return trimmed, "true", true
+	}
+
+	if dashed {
+		return trimmed, "", true
+	}
+
+	return "", "", false
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return NewLocalizedError("不是bool: %s", value)
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return NewLocalizedError("不是整数: %s", value)
+		}
+		field.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return NewLocalizedError("不是非负整数: %s", value)
+		}
+		field.SetUint(i)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return NewLocalizedError("不是数字: %s", value)
+		}
+		field.SetFloat(f)
+	}
+
+	return nil
+}
+
+// RegisterCommand 注册声明式的命令, 和RegisterMentionCommand共用路由顺序.
+// 参数不合法时会把错误和用法回复给发命令的人, 不会调用cmd
+func (m *Manager) RegisterCommand(spec CommandSpec, cmd ArgsCommand, options ...registerOption) error {
+	parsed, err := newCommandSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	process := func(ctx context.Context, ev *slackevents.AppMentionEvent, _ []string) {
+		args, err := parsed.parse(ev.Text)
+		if err != nil {
+			c := FromContext(ctx)
+			m.logger.Info("命令参数错误", Fields{"command": parsed.Name, "user": ev.User, "text": ev.Text, "error": err})
+
+			m.slackApi.PostEphemeralContext(ctx, ev.Channel, ev.User, slack.MsgOptionText(c.ErrorText(parsed.usageError(err)), false))
+			return
+		}
+
+		cmd(ctx, ev, args)
+	}
+
+	options = append([]registerOption{Description(spec.Description), Usage(parsed.Usage())}, options...)
+
+	return m.registerMentionCommand(parsed.pattern(), process, parsed, options)
+}
@@ -0,0 +1,111 @@
+package slackbot
+
+import (
+	"strings"
+	"testing"
+)
+
+type buildArgs struct {
+	Target string `arg:"target" desc:"构建目标" validate:"required"`
+	Clean  bool   `flag:"clean" desc:"clean build"`
+	Commit string `flag:"commit" desc:"指定commit" validate:"omitempty,hexadecimal"`
+	Delay  int    `flag:"delay" validate:"min=0"`
+}
+
+func TestCommandSpecParse(t *testing.T) {
+	spec, err := newCommandSpec(CommandSpec{Name: "build", Description: "新建构建", Args: buildArgs{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage := spec.Usage(); usage != "build <target> [--clean] [--commit=<commit>] [--delay=<delay>]" {
+		t.Errorf("unexpected usage: %s", usage)
+	}
+
+	cases := []struct {
+		text   string
+		expect buildArgs
+	}{
+		{"<@B1> build ios", buildArgs{Target: "ios"}},
+		{"<@B1> build ios --clean", buildArgs{Target: "ios", Clean: true}},
+		{"<@B1>  build ios clean", buildArgs{Target: "ios", Clean: true}},
+		{"<@B1> build --clean=false ios commit=abc12 --delay=5", buildArgs{Target: "ios", Commit: "abc12", Delay: 5}},
+	}
+
+	for _, c := range cases {
+		args, err := spec.parse(c.text)
+		if err != nil {
+			t.Errorf("%s: %s", c.text, err)
+			continue
+		}
+
+		if got := *args.(*buildArgs); got != c.expect {
+			t.Errorf("%s: expect %+v, got %+v", c.text, c.expect, got)
+		}
+	}
+
+	for _, text := range []string{
+		"<@B1> build",
+		"<@B1> build ios android",
+		"<@B1> build ios --verbose",
+		"<@B1> build ios commit=xyz",
+		"<@B1> build ios --delay=soon",
+		"<@B1> build ios --delay=-1",
+	} {
+		if _, err := spec.parse(text); err == nil {
+			t.Errorf("%s: expect error", text)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	m := New("", "")
+
+	if err := m.RegisterCommand(CommandSpec{Name: "build", Args: buildArgs{}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RegisterCommand(CommandSpec{Name: "env set"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RegisterCommand(CommandSpec{Name: "bad", Args: "string"}, nil); err == nil {
+		t.Error("expect error for non-struct args")
+	}
+
+	if command, _ := m.matchMentionCommand("<@B1> build ios --clean"); command == nil || command.spec.Name != "build" {
+		t.Errorf("build not matched")
+	}
+
+	if command, _ := m.matchMentionCommand("<@B1> buildall"); command != nil {
+		t.Errorf("unexpected match: %s", command.pattern)
+	}
+
+	if command, _ := m.matchMentionCommand("<@B1> env  set"); command == nil || command.spec.Name != "env set" {
+		t.Errorf("env set not matched")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	spec := CommandSpec{Name: "build", Args: buildArgs{}}
+
+	args, err := ParseCommand(spec, "build ios clean --commit=abc12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *args.(*buildArgs); got != (buildArgs{Target: "ios", Clean: true, Commit: "abc12"}) {
+		t.Errorf("unexpected args: %+v", got)
+	}
+
+	m := New("", "")
+	for _, text := range []string{"", "install ios 3", "build", "build ios commit=xyz"} {
+		_, err := ParseCommand(spec, text)
+		if err == nil {
+			t.Errorf("%q: expect error", text)
+			continue
+		}
+		if msg := m.ErrorText("en", err); !strings.Contains(msg, "usage: build <target>") {
+			t.Errorf("%q: unexpected error: %s", text, msg)
+		}
+	}
+}
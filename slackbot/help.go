@@ -0,0 +1,248 @@
+package slackbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"regexp"
+	"strings"
+)
+
+var helpCommand = regexp.MustCompile(`(?i)^help(\s+(.+))?$`)
+
+// name 命令在help里的名字, 没有spec和Name时取usage的第一个词. 只用于help, 权限配置不用usage
+func (c *mentionCommand) name() string {
+	if c.spec != nil {
+		return c.spec.Name
+	}
+	if c.registration.name != "" {
+		return c.registration.name
+	}
+	if words := strings.Fields(c.usage); len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
+
+func (c *mentionCommand) displayUsage() string {
+	if c.usage != "" {
+		return c.usage
+	}
+	return c.pattern
+}
+
+// findCommand 按名字查找命令, 名字可以是多个词
+func (m *Manager) findCommand(name string) *mentionCommand {
+	name = strings.Join(strings.Fields(name), " ")
+	for _, c := range m.commands {
+		if n := c.name(); n != "" && strings.EqualFold(n, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// HelpBlocks command为空时列出所有注册的命令, 否则返回这个命令的详细用法.
+// 标题和Description按locale翻译, Description可以直接写成catalog里的原文
+func (m *Manager) HelpBlocks(locale, command string) ([]slack.Block, error) {
+	t := m.Translator(locale)
+
+	if strings.TrimSpace(command) != "" {
+		c := m.findCommand(command)
+		if c == nil {
+			return nil, NewLocalizedError("没有这个命令: %s", command)
+		}
+		return commandHelpBlocks(c, t), nil
+	}
+
+	var blocks []slack.Block
+
+	var lines []string
+	for _, c := range m.commands {
+		lines = append(lines, helpLine(c.displayUsage(), t(c.description)))
+	}
+	if len(lines) > 0 {
+		blocks = append(blocks, markdownSection("*"+t("可用的命令")+"*\n"+strings.Join(lines, "\n")))
+	}
+
+	var slashLines, callbackLines []string
+	for _, h := range m.callbacks {
+		switch {
+		case h.kind == KindSlashCommand:
+			usage := h.id
+			if h.usage != "" {
+				usage = h.usage
+			}
+			slashLines = append(slashLines, helpLine(usage, t(h.description)))
+		case h.description != "":
+			callbackLines = append(callbackLines, fmt.Sprintf("%s `%s` %s", strings.Replace(h.kind, "_", " ", -1), escapeMrkdwn(h.id), escapeMrkdwn(t(h.description))))
+		}
+	}
+	if len(slashLines) > 0 {
+		blocks = append(blocks, markdownSection("*Slash commands*\n"+strings.Join(slashLines, "\n")))
+	}
+	if len(callbackLines) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(callbackLines, "\n"), false, false)))
+	}
+
+	if len(blocks) == 0 {
+		blocks = append(blocks, markdownSection(t("还没有注册任何命令")))
+	} else {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, t("发送 `help &lt;命令&gt;` 查看详细用法, `lang` 切换语言"), false, false)))
+	}
+
+	return blocks, nil
+}
+
+func commandHelpBlocks(c *mentionCommand, t Translator) []slack.Block {
+	text := fmt.Sprintf("*%s*\n`%s`", escapeMrkdwn(c.name()), escapeMrkdwn(c.displayUsage()))
+	if c.description != "" {
+		text += "\n" + escapeMrkdwn(t(c.description))
+	}
+	blocks := []slack.Block{markdownSection(text)}
+
+	if c.spec == nil {
+		return blocks
+	}
+
+	var fields []*slack.TextBlockObject
+	for _, arg := range c.spec.args {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("`%s`\n%s", escapeMrkdwn(arg.name), escapeMrkdwn(t(arg.description))), false, false))
+	}
+	for _, flag := range c.spec.flagList {
+		name := "--" + flag.name
+		if !flag.flag {
+			name += "=<" + flag.name + ">"
+		}
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("`%s`\n%s", escapeMrkdwn(name), escapeMrkdwn(t(flag.description))), false, false))
+	}
+
+	// section最多10个field
+	for len(fields) > 0 {
+		n := len(fields)
+		if n > 10 {
+			n = 10
+		}
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields[:n], nil))
+		fields = fields[n:]
+	}
+
+	return blocks
+}
+
+func helpLine(usage, description string) string {
+	if description == "" {
+		return fmt.Sprintf("`%s`", escapeMrkdwn(usage))
+	}
+	return fmt.Sprintf("`%s` %s", escapeMrkdwn(usage), escapeMrkdwn(description))
+}
+
+var mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeMrkdwn slack会把<>当成链接和mention, 需要转义
+func escapeMrkdwn(text string) string {
+	return mrkdwnEscaper.Replace(text)
+}
+
+func markdownSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// replyUnmatchedMention 没有命令匹配时, 回复help, lang或者未知命令和相近的命令
+func (m *Manager) replyUnmatchedMention(ctx context.Context, teamID string, ev *slackevents.AppMentionEvent, text string) {
+	body := mentionPrefix.ReplaceAllString(text, "")
+
+	if match := langCommand.FindStringSubmatch(body); match != nil {
+		m.replyLang(ctx, teamID, ev.Channel, ev.User, match[2])
+		return
+	}
+
+	locale := m.Locale(ctx, teamID, ev.User)
+
+	if match := helpCommand.FindStringSubmatch(body); match != nil {
+		blocks, err := m.HelpBlocks(locale, match[2])
+		if err == nil {
+			m.slackApi.PostEphemeralContext(ctx, ev.Channel, ev.User, slack.MsgOptionText("help", false), slack.MsgOptionBlocks(TruncateBlocks(blocks)...))
+			return
+		}
+		body = match[2]
+	}
+
+	msg := m.T(locale, "收到未知的命令: %s", text)
+	m.logger.Info("收到未知的命令", Fields{"user": ev.User, "channel": ev.Channel, "text": text})
+
+	if suggestions := m.suggestCommands(body); len(suggestions) > 0 {
+		msg += "\n" + m.T(locale, "你是不是想用: %s", strings.Join(suggestions, ", "))
+	}
+	msg += "\n" + m.T(locale, "发送 help 查看所有命令")
+
+	m.slackApi.PostEphemeralContext(ctx, ev.Channel, ev.User, slack.MsgOptionText(msg, false))
+}
+
+// suggestCommands 找出和输入的命令名相近的命令
+func (m *Manager) suggestCommands(text string) []string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return nil
+	}
+
+	var result []string
+	for _, c := range m.commands {
+		name := strings.ToLower(c.name())
+		if name == "" {
+			continue
+		}
+
+		n := len(strings.Fields(name))
+		if n > len(words) {
+			n = len(words)
+		}
+		input := strings.Join(words[:n], " ")
+
+		threshold := 1
+		if len(name) >= 4 {
+			threshold = 2
+		}
+
+		if editDistance(input, name) <= threshold || (len(input) >= 2 && strings.HasPrefix(name, input)) {
+			result = append(result, c.name())
+		}
+	}
+
+	return result
+}
+
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
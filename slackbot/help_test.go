@@ -0,0 +1,121 @@
+package slackbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newHelpManager(t *testing.T) *Manager {
+	m := New("", "")
+
+	if err := m.RegisterCommand(CommandSpec{Name: "build", Description: "新建构建", Args: buildArgs{}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RegisterMentionCommand(`<@.+> ping(.*)`, nil, Description("测试bot是否在线"), Usage("ping [text]")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RegisterMentionCommand(`<@.+> secret`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m.RegisterSlashCommand("/ucb", nil, Description("不用@也能构建"))
+	m.RegisterBlockCallback("cancel_build", nil, Description("取消构建按钮"))
+	m.RegisterBlockCallback("internal", nil)
+
+	return m
+}
+
+func blocksJSON(t *testing.T, blocks []slack.Block) string {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(blocks); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestHelpBlocks(t *testing.T) {
+	m := newHelpManager(t)
+
+	blocks, err := m.HelpBlocks(DefaultLocale, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := blocksJSON(t, blocks)
+	for _, expect := range []string{
+		"`build &lt;target&gt; [--clean] [--commit=&lt;commit&gt;] [--delay=&lt;delay&gt;]` 新建构建",
+		"`ping [text]` 测试bot是否在线",
+		"`&lt;@.+&gt; secret`",
+		"`/ucb` 不用@也能构建",
+		"block callback `cancel_build` 取消构建按钮",
+	} {
+		if !strings.Contains(text, expect) {
+			t.Errorf("help missing %s: %s", expect, text)
+		}
+	}
+
+	if strings.Contains(text, "internal") {
+		t.Errorf("callback without description should be hidden: %s", text)
+	}
+
+	blocks, err = m.HelpBlocks(DefaultLocale, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text = blocksJSON(t, blocks)
+	if !strings.Contains(text, "构建目标") || !strings.Contains(text, "--commit=&lt;commit&gt;") {
+		t.Errorf("unexpected build help: %s", text)
+	}
+
+	if _, err := m.HelpBlocks(DefaultLocale, "deploy"); err == nil {
+		t.Error("expect error for unknown command")
+	}
+}
+
+func TestSuggestCommands(t *testing.T) {
+	m := newHelpManager(t)
+
+	cases := map[string][]string{
+		"biuld ios":  {"build"},
+		"buidl":      {"build"},
+		"bu":         {"build"},
+		"pong":       {"ping"},
+		"deploy ios": nil,
+		"":           nil,
+	}
+
+	for text, expect := range cases {
+		if got := m.suggestCommands(text); !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: expect %v, got %v", text, expect, got)
+		}
+	}
+}
+
+func TestUnknownCommandRoutesToHelp(t *testing.T) {
+	m := newHelpManager(t)
+
+	// 用户注册的help优先于内置的help
+	called := false
+	m.RegisterMentionCommand(`<@.+> help$`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		called = true
+	})
+
+	command, param := m.matchMentionCommand("<@B1> help")
+	if command == nil {
+		t.Fatal("custom help not matched")
+	}
+	command.process(context.Background(), nil, param)
+
+	if !called {
+		t.Error("custom help not called")
+	}
+}
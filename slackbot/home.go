@@ -0,0 +1,125 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"sync"
+)
+
+// HomeRenderer 生成用户的Home tab. ctx里有Context, 可以用FromContext(ctx).T翻译. 返回nil时不更新
+type HomeRenderer func(ctx context.Context, user string) (*slack.HomeTabViewRequest, error)
+
+type homeRegistration struct {
+	registration
+
+	render HomeRenderer
+}
+
+// homeUsers 打开过Home tab的用户, RefreshHome时重新发布. 只在内存里, 进程重启后要等用户再打开一次
+type homeUsers struct {
+	lock  sync.Mutex
+	teams map[string]string
+}
+
+func (h *homeUsers) add(teamID, user string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.teams == nil {
+		h.teams = make(map[string]string)
+	}
+	h.teams[user] = teamID
+}
+
+func (h *homeUsers) all() map[string]string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	result := make(map[string]string, len(h.teams))
+	for user, teamID := range h.teams {
+		result[user] = teamID
+	}
+	return result
+}
+
+// NewHomeView 用BlockBuilder或者BlockTemplates生成的blocks
+func NewHomeView(blocks *slack.Blocks) *slack.HomeTabViewRequest {
+	return &slack.HomeTabViewRequest{Type: slack.VTHomeTab, Blocks: *blocks}
+}
+
+// RegisterHomeRenderer 用户打开Home tab时用renderer生成view, 再用views.publish发布. 需要订阅app_home_opened.
+// 数据变化之后用PublishHome或者RefreshHome更新
+func (m *Manager) RegisterHomeRenderer(renderer HomeRenderer, options ...registerOption) {
+	if m.home != nil {
+		panic("重复注册了home renderer")
+	}
+
+	m.home = &homeRegistration{render: renderer}
+	for _, ops := range options {
+		ops(&m.home.registration)
+	}
+
+	m.RegisterAppHomeOpenedHandler(func(ctx context.Context, ev *slackevents.AppHomeOpenedEvent) {
+		if ev.Tab != "home" {
+			return
+		}
+
+		c := FromContext(ctx)
+		m.homeUsers.add(c.TeamID, ev.User)
+		if err := m.publishHome(c, ev.User); err != nil {
+			ReportError(ctx, err)
+		}
+	}, options...)
+}
+
+// PublishHome 重新生成并发布一个用户的Home tab
+func (m *Manager) PublishHome(ctx context.Context, teamID, user string) error {
+	if m.home == nil {
+		return errors.New("没有注册home renderer")
+	}
+
+	req := &Request{
+		Kind:   KindHome,
+		ID:     KindHome,
+		Name:   KindHome,
+		TeamID: teamID,
+		User:   user,
+	}
+
+	return m.execute(ctx, req, &m.home.registration, func(ctx context.Context) {
+		if err := m.publishHome(FromContext(ctx), user); err != nil {
+			ReportError(ctx, err)
+		}
+	})
+}
+
+// RefreshHome 给所有打开过Home tab的用户重新发布, 比如构建状态变化之后. 返回最后一个错误
+func (m *Manager) RefreshHome(ctx context.Context) error {
+	var lastErr error
+	for user, teamID := range m.homeUsers.all() {
+		if err := m.PublishHome(ctx, teamID, user); err != nil {
+			m.logger.Warn("更新Home tab失败", Fields{"team": teamID, "user": user, "error": err})
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (m *Manager) publishHome(c *Context, user string) error {
+	view, err := m.home.render(c, user)
+	if err != nil || view == nil {
+		return err
+	}
+
+	if view.Type == "" {
+		view.Type = slack.VTHomeTab
+	}
+	if err := validateBlocks(TruncateBlocks(view.Blocks.BlockSet), MaxViewBlocks); err != nil {
+		return errors.Wrap(err, "home tab不满足slack的限制")
+	}
+
+	_, err = c.Client.PublishViewContext(c, user, *view, "")
+	return errors.Wrap(err, "发布home tab失败")
+}
@@ -0,0 +1,39 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+func TestHomeRenderer(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "verify", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	if err := m.PublishHome(context.Background(), "T1", "U1"); err == nil {
+		t.Error("publish without renderer should fail")
+	}
+
+	var rendered []string
+	m.RegisterHomeRenderer(func(ctx context.Context, user string) (*slack.HomeTabViewRequest, error) {
+		rendered = append(rendered, user+" "+FromContext(ctx).TeamID)
+		return NewHomeView(Blocks().Header("最近的构建").Build()), nil
+	})
+
+	postEvent(m, "verify", `{"type":"app_home_opened","user":"U1","channel":"D1","tab":"home"}`)
+	postEvent(m, "verify", `{"type":"app_home_opened","user":"U2","channel":"D2","tab":"messages"}`)
+
+	if err := m.RefreshHome(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if expect := []string{"U1 T1", "U1 T1"}; !reflect.DeepEqual(rendered, expect) {
+		t.Errorf("unexpected renders: %q", rendered)
+	}
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, []string{"/views.publish", "/views.publish"}) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
@@ -0,0 +1,29 @@
+package slackbot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Handler 包含/message, /interact和/command三个路由, 可以直接交给http.ListenAndServe.
+// 其它框架用Serve开头的方法自己注册路由
+func (m *Manager) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/message", m.ServeMessageEvent)
+	mux.HandleFunc("/interact", m.ServeCallbackEvent)
+	mux.HandleFunc("/command", m.ServeSlashCommand)
+	return mux
+}
+
+func writeString(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	io.WriteString(w, body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
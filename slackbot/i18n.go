@@ -0,0 +1,348 @@
+package slackbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLocale 代码里的消息都是中文, 没有翻译时直接用原文
+const DefaultLocale = "zh"
+
+// Catalog 一种语言的翻译. key是代码里的中文原文(fmt的格式), value是翻译后的格式
+type Catalog map[string]string
+
+// Catalogs key是语言, 比如en. 带地区的语言(en-US)找不到时会用en
+type Catalogs map[string]Catalog
+
+// Translator 按某个语言翻译消息, args按fmt的格式填进去
+type Translator func(format string, args ...interface{}) string
+
+const slackLocaleCacheTTL = time.Hour
+
+// localeCache 用户通过lang命令选择的语言, 和users.info返回的locale的缓存
+type localeCache struct {
+	sync.Mutex
+
+	chosen map[string]string
+	slack  map[string]cachedLocale
+}
+
+type cachedLocale struct {
+	locale string
+	expire time.Time
+}
+
+// builtinCatalogs 库自己回复给用户的消息
+var builtinCatalogs = Catalogs{
+	"en": {
+		"收到未知的命令: %s":    "Unknown command: %s",
+		"你是不是想用: %s":     "Did you mean: %s",
+		"发送 help 查看所有命令": "Send help to list all commands",
+		"可用的命令":          "Commands",
+		"还没有注册任何命令":      "No commands registered yet",
+		"发送 `help &lt;命令&gt;` 查看详细用法, `lang` 切换语言": "Send `help &lt;command&gt;` for details, `lang` to change the language",
+		"没有这个命令: %s":       "No such command: %s",
+		"%s\n用法: %s":       "%s\nusage: %s",
+		"多余的参数: %s":        "Unexpected argument: %s",
+		"未知的参数: %s":        "Unknown argument: %s",
+		"参数%s: %s":         "argument %s: %s",
+		"参数%s不满足%s":        "argument %s must satisfy %s",
+		"不是bool: %s":       "not a bool: %s",
+		"不是整数: %s":         "not an integer: %s",
+		"不是非负整数: %s":       "not a non-negative integer: %s",
+		"不是数字: %s":         "not a number: %s",
+		"%s不能在这个channel使用": "%s can't be used in this channel",
+		"你没有权限使用%s":        "You don't have permission to use %s",
+		"当前语言: %s, 可用的语言: %s. 发送 lang en 这样的命令切换, lang auto 恢复默认": "Current language: %s, available: %s. Send something like lang zh to switch, lang auto to reset",
+		"已恢复默认语言: %s":           "Reset to the default language: %s",
+		"已切换到%s":                "Switched to %s",
+		"不支持的语言: %s, 可用的语言: %s": "Unsupported language: %s, available: %s",
+		"按钮的数据无效, 请重新操作":        "This action is no longer valid, please try again",
+		"操作已过期, 请重新发起":          "This action has expired, please start over",
+		"bot正忙, 请稍后再试":          "The bot is busy, please try again later",
+		"没有权限":                  "Permission denied",
+		"关闭":                    "Close",
+	},
+}
+
+var langCommand = regexp.MustCompile(`(?i)^lang(\s+(\S+))?$`)
+
+// WithCatalogs 添加翻译, 同一个语言的多个catalog会合并, 后面的覆盖前面的
+func WithCatalogs(catalogs Catalogs) option {
+	return func(manager *Manager) {
+		if manager.catalogs == nil {
+			manager.catalogs = Catalogs{}
+		}
+		for locale, catalog := range catalogs {
+			locale = normalizeLocale(locale)
+			if manager.catalogs[locale] == nil {
+				manager.catalogs[locale] = Catalog{}
+			}
+			for k, v := range catalog {
+				manager.catalogs[locale][k] = v
+			}
+		}
+	}
+}
+
+// WithLocale 设置workspace的默认语言. teamID为空时是所有workspace的默认语言
+func WithLocale(teamID, locale string) option {
+	return func(manager *Manager) {
+		if manager.teamLocales == nil {
+			manager.teamLocales = make(map[string]string)
+		}
+		manager.teamLocales[teamID] = normalizeLocale(locale)
+	}
+}
+
+// WithSlackLocale 用户没有用lang命令选择语言时, 用users.info返回的locale. 需要users:read权限
+func WithSlackLocale() option {
+	return func(manager *Manager) {
+		manager.slackLocale = true
+	}
+}
+
+// LoadCatalogs 从yaml读取翻译:
+//
+//	en:
+//	  "收到未知的命令: %s": "Unknown command: %s"
+//	  "新建构建": "Start a build"
+func LoadCatalogs(path string) (Catalogs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取翻译失败")
+	}
+	return ParseCatalogs(data)
+}
+
+// ParseCatalogs 和LoadCatalogs一样, 翻译直接写在代码里时使用
+func ParseCatalogs(data []byte) (Catalogs, error) {
+	result := Catalogs{}
+	if err := yaml.UnmarshalStrict(data, &result); err != nil {
+		return nil, errors.Wrap(err, "解析翻译失败")
+	}
+	return result, nil
+}
+
+// normalizeLocale en_US, en-US都转成en-us
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+// catalog 先找完整的locale, 再找语言. 都没有时返回nil, 使用原文
+func (m *Manager) catalog(locale string) Catalog {
+	locale = normalizeLocale(locale)
+	if c, has := m.catalogs[locale]; has {
+		return c
+	}
+	if i := strings.Index(locale, "-"); i > 0 {
+		return m.catalogs[locale[:i]]
+	}
+	return nil
+}
+
+// supportsLocale DefaultLocale和有catalog的语言
+func (m *Manager) supportsLocale(locale string) bool {
+	locale = normalizeLocale(locale)
+	return locale == DefaultLocale || strings.HasPrefix(locale, DefaultLocale+"-") || m.catalog(locale) != nil
+}
+
+func (m *Manager) availableLocales() []string {
+	result := []string{DefaultLocale}
+	for locale := range m.catalogs {
+		if locale != DefaultLocale {
+			result = append(result, locale)
+		}
+	}
+	sort.Strings(result[1:])
+	return result
+}
+
+// T 把format翻译成locale, 没有翻译时用原文. args里的error如果是NewLocalizedError创建的, 也会翻译
+func (m *Manager) T(locale, format string, args ...interface{}) string {
+	if translated, has := m.catalog(locale)[format]; has {
+		format = translated
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	localized := make([]interface{}, len(args))
+	for i, arg := range args {
+		if err, ok := arg.(error); ok {
+			localized[i] = m.ErrorText(locale, err)
+		} else {
+			localized[i] = arg
+		}
+	}
+
+	return fmt.Sprintf(format, localized...)
+}
+
+// Translator 固定了locale的T, 给template和不方便传locale的地方使用
+func (m *Manager) Translator(locale string) Translator {
+	return func(format string, args ...interface{}) string {
+		return m.T(locale, format, args...)
+	}
+}
+
+// Locale 用户看到的语言: lang命令选择的语言, users.info的locale(WithSlackLocale), workspace的默认语言, DefaultLocale
+func (m *Manager) Locale(ctx context.Context, teamID, user string) string {
+	if user != "" {
+		if locale := m.userLocale(ctx, teamID, user); locale != "" {
+			return locale
+		}
+	}
+
+	if locale, has := m.teamLocales[teamID]; has {
+		return locale
+	}
+	if locale, has := m.teamLocales[""]; has {
+		return locale
+	}
+	return DefaultLocale
+}
+
+func (m *Manager) userLocale(ctx context.Context, teamID, user string) string {
+	c := &m.locales
+	key := teamID + "/" + user
+
+	c.Lock()
+	chosen, hasChosen := c.chosen[key]
+	cached, hasCached := c.slack[key]
+	c.Unlock()
+
+	if hasChosen {
+		return chosen
+	}
+	if !m.slackLocale {
+		return ""
+	}
+	if hasCached && time.Now().Before(cached.expire) {
+		return cached.locale
+	}
+
+	// 出错时也缓存, 避免每条消息都调用users.info
+	locale := ""
+	info, err := m.slackApi.GetUserInfoContext(ctx, user)
+	if err != nil {
+		m.logger.Warn("获取用户的locale失败", Fields{"team": teamID, "user": user, "error": err})
+	} else if m.supportsLocale(info.Locale) {
+		locale = normalizeLocale(info.Locale)
+	}
+
+	c.Lock()
+	if c.slack == nil {
+		c.slack = make(map[string]cachedLocale)
+	}
+	c.slack[key] = cachedLocale{locale: locale, expire: time.Now().Add(slackLocaleCacheTTL)}
+	c.Unlock()
+
+	return locale
+}
+
+// SetUserLocale 和lang命令一样, locale为空时恢复默认. 只保存在内存里, lambda冷启动之后会丢失
+func (m *Manager) SetUserLocale(teamID, user, locale string) error {
+	if locale != "" && !m.supportsLocale(locale) {
+		return NewLocalizedError("不支持的语言: %s, 可用的语言: %s", locale, strings.Join(m.availableLocales(), ", "))
+	}
+
+	c := &m.locales
+	c.Lock()
+	defer c.Unlock()
+
+	key := teamID + "/" + user
+	if locale == "" {
+		delete(c.chosen, key)
+		return nil
+	}
+
+	if c.chosen == nil {
+		c.chosen = make(map[string]string)
+	}
+	c.chosen[key] = normalizeLocale(locale)
+	return nil
+}
+
+// replyLang 处理 @bot lang [locale|auto]
+func (m *Manager) replyLang(ctx context.Context, teamID, channel, user, locale string) {
+	var msg string
+
+	switch {
+	case locale == "":
+		current := m.Locale(ctx, teamID, user)
+		msg = m.T(current, "当前语言: %s, 可用的语言: %s. 发送 lang en 这样的命令切换, lang auto 恢复默认", current, strings.Join(m.availableLocales(), ", "))
+
+	case strings.EqualFold(locale, "auto"):
+		m.SetUserLocale(teamID, user, "")
+		current := m.Locale(ctx, teamID, user)
+		msg = m.T(current, "已恢复默认语言: %s", current)
+
+	default:
+		if err := m.SetUserLocale(teamID, user, locale); err != nil {
+			msg = m.ErrorText(m.Locale(ctx, teamID, user), err)
+		} else {
+			m.logger.Info("用户切换了语言", Fields{"team": teamID, "user": user, "locale": locale})
+			msg = m.T(locale, "已切换到%s", normalizeLocale(locale))
+		}
+	}
+
+	m.slackApi.PostEphemeralContext(ctx, channel, user, slack.MsgOptionText(msg, false))
+}
+
+// localizedError 给用户看的错误. Error()是原文, 回复时用ErrorText翻译
+type localizedError struct {
+	format string
+	args   []interface{}
+}
+
+// NewLocalizedError 和errors.Errorf一样, 但是回复给用户时会按用户的语言翻译format
+func NewLocalizedError(format string, args ...interface{}) error {
+	return &localizedError{format: format, args: args}
+}
+
+func (e *localizedError) Error() string {
+	if len(e.args) == 0 {
+		return e.format
+	}
+	return fmt.Sprintf(e.format, e.args...)
+}
+
+// localizedErrors 多个错误一起回复, 比如多个参数校验失败
+type localizedErrors []error
+
+func (e localizedErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// ErrorText 翻译NewLocalizedError创建的错误, 其它错误返回Error()
+func (m *Manager) ErrorText(locale string, err error) string {
+	switch e := err.(type) {
+	case *localizedError:
+		return m.T(locale, e.format, e.args...)
+	case *deniedError:
+		return m.ErrorText(locale, e.reason)
+	case localizedErrors:
+		var msgs []string
+		for _, item := range e {
+			msgs = append(msgs, m.ErrorText(locale, item))
+		}
+		return strings.Join(msgs, ", ")
+	default:
+		return err.Error()
+	}
+}
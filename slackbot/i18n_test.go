@@ -0,0 +1,126 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+)
+
+var testCatalogs = []byte(`
+en:
+  "构建目标": "Build target"
+  "新建构建": "New build"
+  "启动成功: %s": "Started: %s"
+`)
+
+func TestTranslate(t *testing.T) {
+	catalogs, err := ParseCatalogs(testCatalogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New("", "", WithCatalogs(catalogs))
+
+	cases := []struct {
+		locale, format string
+		args           []interface{}
+		expect         string
+	}{
+		{"en", "构建目标", nil, "Build target"},
+		{"en-US", "启动成功: %s", []interface{}{"ios"}, "Started: ios"},
+		{"zh", "启动成功: %s", []interface{}{"ios"}, "启动成功: ios"},
+		{"en", "没有翻译", nil, "没有翻译"},
+		{"en", "%s\n用法: %s", []interface{}{NewLocalizedError("参数%s: %s", "build", NewLocalizedError("不是整数: %s", "x")), "install"}, "argument build: not an integer: x\nusage: install"},
+	}
+
+	for _, c := range cases {
+		if got := m.T(c.locale, c.format, c.args...); got != c.expect {
+			t.Errorf("%s %q: expect %q, got %q", c.locale, c.format, c.expect, got)
+		}
+	}
+
+	if got := NewLocalizedError("不是整数: %s", "x").Error(); got != "不是整数: x" {
+		t.Errorf("Error() should be the original text: %s", got)
+	}
+}
+
+func TestTemplateT(t *testing.T) {
+	catalogs, _ := ParseCatalogs(testCatalogs)
+	m := New("", "", WithCatalogs(catalogs), WithLocale("", "en"))
+
+	block := `[{"type": "section", "text": {"type": "plain_text", "text": "{{T "构建目标"}}"}}]`
+
+	c := m.newContext(context.Background(), &Request{User: "U1"})
+	view, err := c.NewModalView("launcher", "新建构建", "", block, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Title.Text != "New build" || view.Blocks.BlockSet[0].(*slack.SectionBlock).Text.Text != "Build target" {
+		t.Errorf("unexpected view: %s %+v", view.Title.Text, view.Blocks.BlockSet[0])
+	}
+
+	// 不经过Context时T只返回原文
+	blocks, err := NewBlockMessage(block, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks.BlockSet[0].(*slack.SectionBlock).Text.Text != "构建目标" {
+		t.Errorf("unexpected block: %+v", blocks.BlockSet[0])
+	}
+}
+
+func TestLangCommand(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+	api.locale = "en-US"
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")), WithSlackLocale())
+
+	mention := func(text string) string {
+		m.replyUnmatchedMention(context.Background(), "T1", &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: text}, text)
+		texts := api.takeTexts()
+		if len(texts) != 1 {
+			t.Fatalf("%s: expect one reply, got %q", text, texts)
+		}
+		return texts[0]
+	}
+
+	// users.info的locale是en-US
+	if got := mention("<@B1> deploy"); got != "Unknown command: <@B1> deploy\nSend help to list all commands" {
+		t.Errorf("unexpected reply: %q", got)
+	}
+
+	if got := mention("<@B1> lang zh"); got != "已切换到zh" {
+		t.Errorf("unexpected reply: %q", got)
+	}
+	if got := m.Locale(context.Background(), "T1", "U1"); got != "zh" {
+		t.Errorf("lang should override users.info: %s", got)
+	}
+	if got := m.Locale(context.Background(), "T2", "U1"); got != "en-us" {
+		t.Errorf("lang is per workspace: %s", got)
+	}
+
+	if got := mention("<@B1> lang fr"); got != "不支持的语言: fr, 可用的语言: zh, en" {
+		t.Errorf("unexpected reply: %q", got)
+	}
+
+	if got := mention("<@B1> lang auto"); got != "Reset to the default language: en-us" {
+		t.Errorf("unexpected reply: %q", got)
+	}
+
+	// users.info的结果会缓存
+	if n := api.countCalls("/users.info"); n != 2 {
+		t.Errorf("users.info should be cached per workspace and user, called %d times", n)
+	}
+}
+
+func TestTeamLocale(t *testing.T) {
+	m := New("", "", WithLocale("", "en"), WithLocale("T2", "zh"))
+
+	if got := m.Locale(context.Background(), "T1", "U1"); got != "en" {
+		t.Errorf("default locale: %s", got)
+	}
+	if got := m.Locale(context.Background(), "T2", "U1"); got != "zh" {
+		t.Errorf("team locale: %s", got)
+	}
+}
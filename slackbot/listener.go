@@ -0,0 +1,125 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack/slackevents"
+	"regexp"
+	"strings"
+)
+
+// Listener 不用@bot, channel里的普通消息匹配到pattern就执行. match是FindStringSubmatch的结果
+type Listener func(ctx context.Context, ev *slackevents.MessageEvent, match []string)
+
+type listener struct {
+	registration
+
+	pattern string
+	reg     *regexp.Regexp
+	process Listener
+}
+
+// WithDirectMessages 私信给bot的消息也按命令路由, 不需要@bot. slack app里需要订阅message.im
+func WithDirectMessages() option {
+	return func(manager *Manager) {
+		manager.directMessages = true
+	}
+}
+
+// Channels 只在这些channel里生效, 不设置时在bot所在的所有channel里生效. 只对listener有效
+func Channels(channels ...string) registerOption {
+	return func(r *registration) {
+		r.channels = append(r.channels, channels...)
+	}
+}
+
+// RegisterListener 注册channel消息的关键字监听, 匹配的listener都会执行. 需要订阅message.channels或者message.groups.
+// 一般配合Channels使用, 以免在所有channel里都触发
+func (m *Manager) RegisterListener(reg string, process Listener, options ...registerOption) error {
+	compiled, err := regexp.Compile(reg)
+	if err != nil {
+		return errors.Wrapf(err, "listener不是合法的正则: %s", reg)
+	}
+
+	l := &listener{pattern: reg, reg: compiled, process: process}
+	for _, ops := range options {
+		ops(&l.registration)
+	}
+
+	m.listeners = append(m.listeners, l)
+	return nil
+}
+
+// isDirectMessageChannel 私信的channel id以D开头
+func isDirectMessageChannel(channel string) bool {
+	return strings.HasPrefix(channel, "D")
+}
+
+// dispatchMessage 私信按命令路由, channel里的消息交给listener. 编辑, 删除之类的subtype和bot的消息都不处理
+func (m *Manager) dispatchMessage(ctx context.Context, teamID, eventID string, ev *slackevents.MessageEvent) {
+	if ev.SubType != "" || ev.BotID != "" || ev.User == "" {
+		return
+	}
+
+	if ev.ChannelType == "im" {
+		if m.directMessages {
+			m.dispatchDirectMessage(ctx, teamID, eventID, ev)
+		}
+		return
+	}
+
+	for _, l := range m.listeners {
+		if len(l.channels) > 0 && !contains(l.channels, ev.Channel) {
+			continue
+		}
+
+		match := l.reg.FindStringSubmatch(ev.Text)
+		if match == nil {
+			continue
+		}
+
+		m.logger.Info("消息匹配到listener", Fields{"event_id": eventID, "team": teamID, "user": ev.User, "channel": ev.Channel, "pattern": l.pattern})
+
+		req := &Request{
+			Kind:    KindListener,
+			ID:      l.pattern,
+			Name:    l.pattern,
+			EventID: eventID,
+			TeamID:  teamID,
+			Channel: ev.Channel,
+			User:    ev.User,
+			Text:    ev.Text,
+			Event:   &Event{Type: slackevents.Message, TeamID: teamID, EventID: eventID, Data: ev},
+		}
+
+		l := l // 可能在后台执行
+		m.schedule(ctx, req, &l.registration, func(ctx context.Context) {
+			l.process(ctx, ev, match)
+		})
+	}
+}
+
+// dispatchDirectMessage 没有@bot时在前面补上, 命令的pattern和参数解析不用区分私信
+func (m *Manager) dispatchDirectMessage(ctx context.Context, teamID, eventID string, ev *slackevents.MessageEvent) {
+	m.logger.Info("收到私信", Fields{"event_id": eventID, "team": teamID, "user": ev.User, "channel": ev.Channel, "text": ev.Text})
+
+	text := strings.TrimSpace(ev.Text)
+	if !mentionPrefix.MatchString(text) {
+		botID := m.botUserID(ctx)
+		if botID == "" {
+			// 拿不到bot的id时随便补一个, pattern只要求有mention
+			botID = "bot"
+		}
+		text = "<@" + botID + "> " + text
+	}
+
+	m.dispatchMention(ctx, teamID, eventID, &slackevents.AppMentionEvent{
+		Type:            slackevents.AppMention,
+		User:            ev.User,
+		Text:            text,
+		TimeStamp:       ev.TimeStamp,
+		ThreadTimeStamp: ev.ThreadTimeStamp,
+		Channel:         ev.Channel,
+		EventTimeStamp:  ev.EventTimeStamp,
+	})
+}
@@ -0,0 +1,74 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"reflect"
+	"testing"
+)
+
+func TestDirectMessages(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "verify", WithDirectMessages(), WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	var calls []string
+	m.RegisterMentionCommand(`^<@.+> build (\S+)`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		calls = append(calls, cmd[1]+" "+FromContext(ctx).Channel+" "+RequestFromContext(ctx).Kind)
+	})
+
+	postEvent(m, "verify", `{"type":"message","channel_type":"im","user":"U1","channel":"D1","ts":"1.0","text":"build ios"}`)
+	postEvent(m, "verify", `{"type":"message","channel_type":"im","user":"U1","channel":"D1","ts":"2.0","text":"<@B1> build android"}`)
+	// 私信里@bot时还会收到app_mention, 不能执行两次
+	postEvent(m, "verify", `{"type":"app_mention","user":"U1","channel":"D1","ts":"2.0","text":"<@B1> build android"}`)
+	// channel里不@bot不是命令
+	postEvent(m, "verify", `{"type":"message","channel_type":"channel","user":"U1","channel":"C1","ts":"3.0","text":"build web"}`)
+	// bot自己的私信
+	postEvent(m, "verify", `{"type":"message","channel_type":"im","bot_id":"B1","channel":"D1","ts":"4.0","text":"build ios"}`)
+	// channel里@bot, 别的bot的mention不算
+	postEvent(m, "verify", `{"type":"app_mention","user":"U1","channel":"C1","ts":"5.0","text":"<@B1> build web"}`)
+	postEvent(m, "verify", `{"type":"app_mention","bot_id":"B2","channel":"C1","ts":"6.0","text":"<@B1> build web"}`)
+
+	expect := []string{
+		"ios D1 mention_command",
+		"android D1 mention_command",
+		"web C1 mention_command",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	m := New("", "verify")
+
+	var calls []string
+	err := m.RegisterListener(`(?i)\b(ios|android) build (failed|broken)\b`, func(ctx context.Context, ev *slackevents.MessageEvent, match []string) {
+		calls = append(calls, "broken "+match[1]+" "+FromContext(ctx).Channel)
+	}, Channels("C1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RegisterListener(`ios`, func(ctx context.Context, ev *slackevents.MessageEvent, match []string) {
+		calls = append(calls, "ios "+FromContext(ctx).Channel)
+	})
+
+	if err := m.RegisterListener(`(`, nil); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+
+	postEvent(m, "verify", `{"type":"message","channel_type":"channel","user":"U1","channel":"C1","ts":"1.0","text":"iOS build failed again"}`)
+	postEvent(m, "verify", `{"type":"message","channel_type":"channel","user":"U1","channel":"C2","ts":"2.0","text":"ios build failed"}`)
+	postEvent(m, "verify", `{"type":"message","channel_type":"channel","subtype":"message_changed","channel":"C1","ts":"3.0","message":{"text":"ios build failed"}}`)
+	postEvent(m, "verify", `{"type":"message","channel_type":"channel","bot_id":"B1","channel":"C1","ts":"4.0","text":"ios build failed"}`)
+
+	expect := []string{
+		"broken iOS C1",
+		"ios C2",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
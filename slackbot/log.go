@@ -0,0 +1,169 @@
+package slackbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields 结构化日志的字段, 比如event_id, team, user, command, duration
+type Fields map[string]interface{}
+
+// Logger Manager的所有日志都通过它输出, 用WithLogger替换
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// WithLogger 替换默认的JSON logger
+func WithLogger(logger Logger) option {
+	return func(manager *Manager) {
+		manager.logger = logger
+	}
+}
+
+// jsonLogger 每条日志一行json, CloudWatch Logs Insights可以直接按字段查询
+type jsonLogger struct {
+	lock  sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// NewJSONLogger 低于level的日志不输出. 字段会先经过Redact
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	return &jsonLogger{w: w, level: level}
+}
+
+// Logger handler以外的地方也用同一个logger, 比如普通的http handler
+func (m *Manager) Logger() Logger {
+	return m.logger
+}
+
+func defaultLogger() Logger {
+	return NewJSONLogger(os.Stdout, LevelInfo)
+}
+
+func (l *jsonLogger) Debug(msg string, fields Fields) { l.log(LevelDebug, msg, fields) }
+func (l *jsonLogger) Info(msg string, fields Fields)  { l.log(LevelInfo, msg, fields) }
+func (l *jsonLogger) Warn(msg string, fields Fields)  { l.log(LevelWarn, msg, fields) }
+func (l *jsonLogger) Error(msg string, fields Fields) { l.log(LevelError, msg, fields) }
+
+func (l *jsonLogger) log(level Level, msg string, fields Fields) {
+	if level < l.level {
+		return
+	}
+
+	entry := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = logValue(k, v)
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "error": "日志字段无法序列化: " + err.Error()})
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.w.Write(append(data, '\n'))
+}
+
+// logValue error和duration转成可读的字符串, 其它值经过Redact
+func logValue(key string, v interface{}) interface{} {
+	if sensitiveKeys[strings.ToLower(key)] {
+		return redacted
+	}
+
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return Redact(v)
+	}
+}
+
+const redacted = "[REDACTED]"
+
+var sensitiveKeys = map[string]bool{
+	"token":              true,
+	"access_token":       true,
+	"bot_access_token":   true,
+	"app_token":          true,
+	"verification_token": true,
+	"signing_secret":     true,
+	"client_secret":      true,
+	"authorization":      true,
+}
+
+// Redact 把v按json的结构展开, 去掉token之类的字段. 用来记录slack的payload
+func Redact(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+
+	return redactValue(generic)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if sensitiveKeys[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(item)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,91 @@
+package slackbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLogger(&buf, LevelInfo)
+
+	logger.Debug("不输出", nil)
+	logger.Info("收到callback", Fields{
+		"user":     "U1",
+		"token":    "secret",
+		"duration": 1500 * time.Millisecond,
+		"error":    errors.New("boom"),
+		"payload":  slack.InteractionCallback{Token: "secret", CallbackID: "cancel_build"},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("debug should be filtered: %q", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry["level"] != "info" || entry["msg"] != "收到callback" || entry["user"] != "U1" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+	if entry["duration"] != "1.5s" || entry["error"] != "boom" {
+		t.Errorf("unexpected duration or error: %v %v", entry["duration"], entry["error"])
+	}
+	if entry["token"] != redacted {
+		t.Errorf("token should be redacted: %v", entry["token"])
+	}
+
+	payload := entry["payload"].(map[string]interface{})
+	if payload["token"] != redacted || payload["callback_id"] != "cancel_build" {
+		t.Errorf("unexpected payload: %v", payload)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("secret leaked: %s", buf.String())
+	}
+}
+
+// recordLogger 记录日志, 测试用
+type recordLogger struct {
+	entries []string
+	fields  []Fields
+}
+
+func (l *recordLogger) Debug(msg string, fields Fields) { l.record("debug", msg, fields) }
+func (l *recordLogger) Info(msg string, fields Fields)  { l.record("info", msg, fields) }
+func (l *recordLogger) Warn(msg string, fields Fields)  { l.record("warn", msg, fields) }
+func (l *recordLogger) Error(msg string, fields Fields) { l.record("error", msg, fields) }
+
+func (l *recordLogger) record(level, msg string, fields Fields) {
+	l.entries = append(l.entries, level+" "+msg)
+	l.fields = append(l.fields, fields)
+}
+
+func TestLoggingMiddlewareFields(t *testing.T) {
+	logger := &recordLogger{}
+	m := New("", "verify", WithLogger(logger))
+	m.Use(Logging())
+
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		ReportError(ctx, errors.New("失败了"))
+	})
+
+	m.dispatchSlashCommand(context.Background(), &slack.SlashCommand{Command: "/ucb", TeamID: "T1", UserID: "U1", ChannelID: "C1"})
+
+	if len(logger.entries) != 2 || logger.entries[1] != "error 执行出错" {
+		t.Fatalf("unexpected entries: %q", logger.entries)
+	}
+
+	fields := logger.fields[1]
+	if fields["command"] != "/ucb" || fields["team"] != "T1" || fields["user"] != "U1" || fields["error"] == nil || fields["duration"] == nil {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+}
@@ -4,20 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/chentmin/once"
-	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
-	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
-var (
-	commandMap map[string]Command
-)
-
 type Command func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string)
 
 type AttachmentCallback func(ctx context.Context, action *slack.AttachmentAction, fullCallback slack.InteractionCallback)
@@ -27,205 +20,348 @@ type BlockCallback func(ctx context.Context, action *slack.BlockAction, fullCall
 type Manager struct {
 	slackToken             string
 	slackVerificationToken string
-
-	commandMap            map[string]Command
+	signingSecret          string
+	stateSecret            string
+
+	commands              []*mentionCommand
+	strictRouting         bool
+	callbacks             []*callbackRegistration
+	middlewares           []Middleware
+	policies              Policies
+	userGroups            userGroupCache
 	attachmentCallbackMap map[string]AttachmentCallback
 	blockCallbackMap      map[string]BlockCallback
-
-	onceDynamoTable string
-
-	slackApi *slack.Client
+	slashCommandMap       map[string]SlashCommand
+	viewSubmissionMap     map[string]ViewSubmission
+	viewClosedMap         map[string]ViewClosed
+	optionsProviderMap    map[string]OptionsProvider
+	globalShortcutMap     map[string]GlobalShortcut
+	messageShortcutMap    map[string]MessageShortcut
+	eventHandlers         []*eventHandler
+	listeners             []*listener
+	directMessages        bool
+	home                  *homeRegistration
+	homeUsers             homeUsers
+	botUser               botUserCache
+	optionsCache          optionsCache
+
+	dedup   DedupStore
+	workers *workerPool
+	// queueLimit 见WithQueueLimit
+	queueLimit int
+	logger     Logger
+
+	catalogs    Catalogs
+	teamLocales map[string]string
+	slackLocale bool
+	locales     localeCache
+
+	slackOptions []slack.Option
+	slackApi     *slack.Client
 }
 
 func New(token, verificationToken string, options ...option) *Manager {
 	result := &Manager{
 		slackToken:             token,
 		slackVerificationToken: verificationToken,
-		commandMap:             make(map[string]Command),
 		attachmentCallbackMap:  make(map[string]AttachmentCallback),
 		blockCallbackMap:       make(map[string]BlockCallback),
-
-		slackApi: slack.New(token),
+		slashCommandMap:        make(map[string]SlashCommand),
+		viewSubmissionMap:      make(map[string]ViewSubmission),
+		viewClosedMap:          make(map[string]ViewClosed),
+		optionsProviderMap:     make(map[string]OptionsProvider),
+		globalShortcutMap:      make(map[string]GlobalShortcut),
+		messageShortcutMap:     make(map[string]MessageShortcut),
 	}
 
+	WithCatalogs(builtinCatalogs)(result)
+
 	for _, ops := range options {
 		ops(result)
 	}
 
+	if result.logger == nil {
+		result.logger = defaultLogger()
+	}
+
+	result.slackApi = slack.New(token, result.slackOptions...)
+
 	return result
 }
 
 type option func(*Manager)
 
-func OnlyOnceByDynamoDB(table string) option {
+// WithSlackOptions 创建slack client时附加的选项, 比如测试时用slack.OptionAPIURL指向假的服务器
+func WithSlackOptions(options ...slack.Option) option {
 	return func(manager *Manager) {
-		manager.onceDynamoTable = table
-	}
-}
-
-func (m *Manager) RegisterMentionCommand(reg string, cmd Command) {
-	if _, has := m.commandMap[reg]; has {
-		panic("重复注册了command: " + reg)
+		manager.slackOptions = append(manager.slackOptions, options...)
 	}
-	m.commandMap[reg] = cmd
 }
 
-func (m *Manager) RegisterAttachmentCallback(reg string, callback AttachmentCallback) {
+func (m *Manager) RegisterAttachmentCallback(reg string, callback AttachmentCallback, options ...registerOption) {
 	if _, has := m.attachmentCallbackMap[reg]; has {
 		panic("重复注册了attachment callback: " + reg)
 	}
 	m.attachmentCallbackMap[reg] = callback
+	m.addCallbackRegistration(KindAttachmentCallback, reg, options)
 }
 
-func (m *Manager) RegisterBlockCallback(reg string, callback BlockCallback) {
+// RegisterBlockCallback reg可以是 cancel_build:{target}:{build} 这样的pattern, 参数在Context.Params里.
+// 完全相同的action id优先, 然后按注册顺序匹配pattern. attachment callback和view的callback id也一样
+func (m *Manager) RegisterBlockCallback(reg string, callback BlockCallback, options ...registerOption) {
 	if _, has := m.blockCallbackMap[reg]; has {
 		panic("重复注册了block callback: " + reg)
 	}
 	m.blockCallbackMap[reg] = callback
+	m.addCallbackRegistration(KindBlockCallback, reg, options)
 }
 
-func (m *Manager) HandleMessageEvent(c *gin.Context) {
-
-	body, _ := ioutil.ReadAll(c.Request.Body)
+// ServeMessageEvent 处理Events API的请求, 对应slack的Event Subscriptions Request URL
+func (m *Manager) ServeMessageEvent(w http.ResponseWriter, r *http.Request) {
+	body, err := m.verifyRequest(r)
+	if err != nil {
+		m.logger.Warn("event请求校验失败", Fields{"error": err})
+		writeString(w, http.StatusUnauthorized, "")
+		return
+	}
 
-	eventsAPIEvent, e := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionVerifyToken(slackevents.TokenComparator{VerificationToken: m.slackVerificationToken}))
+	eventsAPIEvent, e := m.parseEvent(json.RawMessage(body), true)
 	if e != nil {
-		fmt.Printf("收到request, 但是作为event解析失败: %s\n", body)
-		c.String(http.StatusBadRequest, "")
+		var decodeErr *eventDecodeError
+		if errors.As(e, &decodeErr) {
+			m.logger.Warn("event解析失败, 不处理", Fields{"error": e, "body_size": len(body)})
+			writeString(w, http.StatusOK, "")
+			return
+		}
+		m.logger.Warn("收到request, 但是作为event解析失败", Fields{"error": e, "body_size": len(body)})
+		writeString(w, http.StatusBadRequest, "")
 		return
 	}
 
+	// 超时重试说明第一次已经收到了, 只是处理得太久. 其它原因的重试交给DedupStore判断
+	if num, reason := slackRetry(r); num > 0 {
+		m.logger.Info("收到slack的重试", Fields{"retry_num": num, "retry_reason": reason})
+		if reason == "http_timeout" {
+			writeString(w, http.StatusOK, "")
+			return
+		}
+	}
+
 	if eventsAPIEvent.Type == slackevents.URLVerification {
-		var r *slackevents.ChallengeResponse
-		err := json.Unmarshal([]byte(body), &r)
+		var challenge *slackevents.ChallengeResponse
+		err := json.Unmarshal([]byte(body), &challenge)
 		if err != nil {
 			return
 		}
 
-		c.String(http.StatusOK, r.Challenge)
+		writeString(w, http.StatusOK, challenge.Challenge)
 		return
 	}
 
-	defer func() {
-		c.String(http.StatusOK, "")
-	}()
+	m.dispatchEvent(r.Context(), eventsAPIEvent)
+
+	writeString(w, http.StatusOK, "")
+}
 
+// dispatchEvent 处理Events API的callback事件, http和socket mode共用
+func (m *Manager) dispatchEvent(ctx context.Context, eventsAPIEvent slackevents.EventsAPIEvent) {
 	if eventsAPIEvent.Type == slackevents.CallbackEvent {
 		innerEvent := eventsAPIEvent.InnerEvent
 
-		fmt.Printf("inner event type: %s\n", innerEvent.Type)
+		var eventID string
+		if cb, ok := eventsAPIEvent.Data.(*slackevents.EventsAPICallbackEvent); ok {
+			eventID = cb.EventID
+		}
+
+		// 同一个事件的重试event_id不变, ts在不同channel之间可能重复
+		if eventID != "" && !m.ensureOnce(ctx, "event:"+eventID) {
+			return
+		}
+
+		handled := m.dispatchEventHandlers(ctx, eventsAPIEvent, eventID)
 
 		switch innerEvent.Type {
 		case slackevents.AppMention:
-			ev := innerEvent.Data.(*slackevents.AppMentionEvent)
-			if m.onceDynamoTable != "" {
-				if err := once.New(m.onceDynamoTable).Ensure(ev.TimeStamp); err != nil {
-					return
-				}
+			ev, ok := innerEvent.Data.(*slackevents.AppMentionEvent)
+			if !ok {
+				m.logger.Warn("mention事件的数据类型不对", Fields{"event_id": eventID, "data": fmt.Sprintf("%T", innerEvent.Data)})
+				return
 			}
 
-			fmt.Printf("收到mention事件: %s: %s\n", ev.User, ev.Text)
-
-			text := strings.TrimSpace(ev.Text)
+			// 私信由message.im处理, 不管有没有mention
+			if m.directMessages && isDirectMessageChannel(ev.Channel) {
+				return
+			}
 
-			processed := false
-			for cmd, process := range m.commandMap {
-				if reg := regexp.MustCompile(cmd); reg.MatchString(text) {
-					param := reg.FindStringSubmatch(text)
-					process(c, ev, param)
-					processed = true
-					break
-				}
+			// 别的bot的mention不当成命令, 和message一样
+			if m.isBotEvent(ctx, &Event{Type: innerEvent.Type, Data: ev}) {
+				m.logger.Debug("忽略bot的mention", Fields{"event_id": eventID, "bot_id": ev.BotID, "channel": ev.Channel})
+				return
 			}
 
-			if !processed {
-				msg := fmt.Sprintf("收到未知的命令: %s\n", text)
-				fmt.Printf(msg)
+			m.logger.Info("收到mention事件", Fields{"event_id": eventID, "team": eventsAPIEvent.TeamID, "user": ev.User, "channel": ev.Channel, "text": ev.Text})
+			m.dispatchMention(ctx, eventsAPIEvent.TeamID, eventID, ev)
+			return
 
-				m.slackApi.PostEphemeral(ev.Channel, ev.User, slack.MsgOptionText(msg, false))
+		case slackevents.Message:
+			ev, ok := innerEvent.Data.(*slackevents.MessageEvent)
+			if !ok {
+				m.logger.Warn("message事件的数据类型不对", Fields{"event_id": eventID, "data": fmt.Sprintf("%T", innerEvent.Data)})
+				return
 			}
-
+			m.dispatchMessage(ctx, eventsAPIEvent.TeamID, eventID, ev)
 			return
 
 		default:
-			fmt.Printf("收到未处理的event type: %s\n", innerEvent.Type)
+			if !handled {
+				m.logger.Debug("收到未处理的event", Fields{"event_id": eventID, "type": innerEvent.Type})
+			}
+			return
 		}
 	}
 
-	fmt.Printf("收到未知的事件: %s\n", body)
+	m.logger.Warn("收到未知的事件", Fields{"type": eventsAPIEvent.Type})
+}
+
+// dispatchMention 按命令路由, 没有匹配的命令时回复help或者lang
+func (m *Manager) dispatchMention(ctx context.Context, teamID, eventID string, ev *slackevents.AppMentionEvent) {
+	text := strings.TrimSpace(ev.Text)
 
-	return
+	if command, param := m.matchMentionCommand(text); command != nil {
+		req := mentionRequest(ev, command)
+		req.TeamID = teamID
+		req.EventID = eventID
+
+		m.schedule(ctx, req, &command.registration, func(ctx context.Context) {
+			command.process(ctx, ev, param)
+		})
+	} else {
+		m.replyUnmatchedMention(ctx, teamID, ev, text)
+	}
 }
 
-func (m *Manager) HandleCallbackEvent(c *gin.Context) {
+// ServeCallbackEvent 处理交互回调的请求, 对应slack的Interactivity Request URL
+func (m *Manager) ServeCallbackEvent(w http.ResponseWriter, r *http.Request) {
+	if _, err := m.verifyRequest(r); err != nil {
+		m.logger.Warn("callback请求校验失败", Fields{"error": err})
+		writeString(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	// view_submission之类的回调需要在response里返回response_action
+	var response interface{}
 	defer func() {
-		c.String(http.StatusOK, "")
+		if response != nil {
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+		writeString(w, http.StatusOK, "")
 	}()
 
-	payload, has := c.GetPostForm("payload")
+	payload := r.PostFormValue("payload")
 
-	if !has {
-		fmt.Printf("callbackk没有payload的formValue\n")
+	if payload == "" {
+		m.logger.Warn("callback没有payload", nil)
 		return
 	}
 
 	var action slack.InteractionCallback
 
 	if err := json.Unmarshal([]byte(payload), &action); err != nil {
-		fmt.Printf("unmarshal payload失败: %s\n", err)
+		m.logger.Warn("解析callback的payload失败", Fields{"error": err})
 		return
 	}
 
-	fmt.Printf("payload: %+v\n", action)
+	// payload里有verification token, Redact会去掉
+	m.logger.Debug("收到callback", Fields{"payload": action})
 
-	if action.Token != m.slackVerificationToken {
-		fmt.Printf("token验证失败\n")
+	if !m.verifyToken(action.Token) {
+		m.logger.Warn("callback的token验证失败", Fields{"team": action.Team.ID, "user": action.User.ID})
 		return
 	}
 
-	if m.onceDynamoTable != "" {
-		if err := once.New(m.onceDynamoTable).Ensure(action.TriggerID); err != nil {
-			return
-		}
+	response = m.dispatchInteraction(r.Context(), action)
+}
+
+// dispatchInteraction 处理交互回调, 返回需要回复给slack的内容, 没有则为nil. http和socket mode共用
+func (m *Manager) dispatchInteraction(ctx context.Context, action slack.InteractionCallback) interface{} {
+	// 交互回调没有event_id. view_closed没有trigger id, 不去重
+	if action.TriggerID != "" && !m.ensureOnce(ctx, "trigger:"+action.TriggerID) {
+		return nil
 	}
+
 	switch action.Type {
 	case slack.InteractionTypeInteractionMessage:
-		fmt.Printf("收到callback事件: %s: %s\n", action.User.Name, action.CallbackID)
-
-		processed := false
-
-		for callback, cmd := range m.attachmentCallbackMap {
-			if callback == action.CallbackID {
-				for _, cb := range action.ActionCallback.AttachmentActions {
-					cmd(c, cb, action)
-				}
-
-				processed = true
-				break
+		m.logger.Info("收到attachment回调", Fields{"team": action.Team.ID, "user": action.User.ID, "callback_id": action.CallbackID})
+
+		if reg, params, ok := m.route(KindAttachmentCallback, action.CallbackID); ok {
+			cmd := m.attachmentCallbackMap[reg]
+			for _, cb := range action.ActionCallback.AttachmentActions {
+				cb := cb // 可能在后台执行
+				m.schedule(ctx, interactionRequest(KindAttachmentCallback, reg, params, &action), m.findCallbackRegistration(KindAttachmentCallback, reg), func(ctx context.Context) {
+					cmd(ctx, cb, action)
+				})
 			}
-		}
-
-		if !processed {
-			fmt.Printf("未知callback id: %s\n", action.CallbackID)
+		} else {
+			m.warnUnrouted(KindAttachmentCallback, action.CallbackID, &action)
 		}
 
 	case slack.InteractionTypeBlockActions:
 		for _, cb := range action.ActionCallback.BlockActions {
-			processed := false
-
-			for callback, cmd := range m.blockCallbackMap {
-				if callback == cb.ActionID {
-					cmd(c, cb, action)
-					processed = true
-					break
-				}
+			cb := cb // 可能在后台执行
+
+			if reg, params, ok := m.route(KindBlockCallback, cb.ActionID); ok {
+				cmd := m.blockCallbackMap[reg]
+				m.schedule(ctx, interactionRequest(KindBlockCallback, reg, params, &action), m.findCallbackRegistration(KindBlockCallback, reg), func(ctx context.Context) {
+					cmd(ctx, cb, action)
+				})
+			} else {
+				m.warnUnrouted(KindBlockCallback, cb.ActionID, &action)
 			}
+		}
 
-			if !processed {
-				fmt.Printf("未知block callback id: %s\n", cb.ActionID)
+	case slack.InteractionTypeViewSubmission:
+		m.logger.Info("收到view submission", Fields{"team": action.Team.ID, "user": action.User.ID, "callback_id": action.View.CallbackID})
+
+		if reg, params, ok := m.route(KindViewSubmission, action.View.CallbackID); ok {
+			callback := m.viewSubmissionMap[reg]
+			registration := m.findCallbackRegistration(KindViewSubmission, reg)
+			req := viewRequest(KindViewSubmission, reg, params, &action, registration)
+
+			var response *slack.ViewSubmissionResponse
+			err := m.execute(ctx, req, registration, func(ctx context.Context) {
+				response = callback(ctx, &action.View, action)
+			})
+
+			if errors.Is(err, ErrDenied) {
+				return m.deniedViewResponse(ctx, req, &action.View, err)
+			}
+			if response != nil {
+				return response
 			}
+		} else {
+			m.warnUnrouted(KindViewSubmission, action.View.CallbackID, &action)
 		}
+
+	case slack.InteractionTypeViewClosed:
+		m.logger.Info("收到view closed", Fields{"team": action.Team.ID, "user": action.User.ID, "callback_id": action.View.CallbackID})
+
+		if reg, params, ok := m.route(KindViewClosed, action.View.CallbackID); ok {
+			callback := m.viewClosedMap[reg]
+			registration := m.findCallbackRegistration(KindViewClosed, reg)
+			m.schedule(ctx, viewRequest(KindViewClosed, reg, params, &action, registration), registration, func(ctx context.Context) {
+				callback(ctx, &action.View, action)
+			})
+		} else {
+			m.warnUnrouted(KindViewClosed, action.View.CallbackID, &action)
+		}
+
+	case slack.InteractionTypeBlockSuggestion:
+		return m.dispatchBlockSuggestion(ctx, action)
+
+	case slack.InteractionTypeShortcut, slack.InteractionTypeMessageAction:
+		m.dispatchShortcut(ctx, action)
 	}
 
-	return
+	return nil
 }
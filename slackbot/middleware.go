@@ -0,0 +1,200 @@
+package slackbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	KindMentionCommand     = "mention_command"
+	KindSlashCommand       = "slash_command"
+	KindAttachmentCallback = "attachment_callback"
+	KindBlockCallback      = "block_callback"
+	KindViewSubmission     = "view_submission"
+	KindViewClosed         = "view_closed"
+	KindBlockSuggestion    = "block_suggestion"
+	KindGlobalShortcut     = "global_shortcut"
+	KindMessageShortcut    = "message_shortcut"
+	KindEvent              = "event"
+	KindListener           = "listener"
+	KindHome               = "app_home"
+)
+
+// Request 一次命令或者回调的执行, 中间件通过它拿到事件的信息
+type Request struct {
+	Kind string
+	// ID 命令的pattern, slash command, callback id, action id或者事件类型. 回调按pattern注册时是注册的pattern
+	ID string
+	// Name 用来查找权限配置. 注册时设置了Name的用它, 否则命令是spec的名字或者pattern, 回调和ID一样
+	Name string
+	// EventID 只有Events API的事件有
+	EventID string
+
+	TeamID  string
+	Channel string
+	User    string
+	Text    string
+	// Params 按 cancel_build:{build} 这样的pattern注册的回调, 从id里取出的参数
+	Params map[string]string
+
+	// 根据Kind, 下面只有一个不为nil
+	Mention     *slackevents.AppMentionEvent
+	Slash       *slack.SlashCommand
+	Interaction *slack.InteractionCallback
+	Event       *Event
+
+	err error
+	// reg Background在后台执行时沿用注册时的权限和超时
+	reg *registration
+}
+
+// Handler 中间件里的下一步. 返回handler通过ReportError报告的错误, 或者后面的中间件返回的错误
+type Handler func(ctx context.Context, req *Request) error
+
+// Middleware 不调用next就可以拦截掉这次执行
+type Middleware func(next Handler) Handler
+
+type requestKey struct{}
+
+// Use 添加的中间件按顺序包在所有命令和回调的外面, 先添加的在最外层
+func (m *Manager) Use(middlewares ...Middleware) {
+	m.middlewares = append(m.middlewares, middlewares...)
+}
+
+// RequestFromContext 在handler和中间件里拿到当前的Request
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+// ReportError handler没有返回值, 用这个把错误交给中间件处理
+func ReportError(ctx context.Context, err error) {
+	if req := RequestFromContext(ctx); req != nil {
+		req.err = err
+	}
+}
+
+// execute 经过中间件和权限检查执行process. reg为nil时只按名字查找权限配置
+func (m *Manager) execute(ctx context.Context, req *Request, reg *registration, process func(ctx context.Context)) error {
+	if reg != nil && reg.name != "" {
+		req.Name = reg.name
+	}
+	req.reg = reg
+
+	h := func(ctx context.Context, req *Request) error {
+		if err := m.authorize(ctx, req, reg); err != nil {
+			if errors.Is(err, ErrDenied) {
+				m.replyDenied(ctx, req, err)
+			}
+			return err
+		}
+
+		process(ctx)
+		return req.err
+	}
+
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		h = m.middlewares[i](h)
+	}
+
+	return h(context.WithValue(m.newContext(ctx, req), requestKey{}, req), req)
+}
+
+func mentionRequest(ev *slackevents.AppMentionEvent, command *mentionCommand) *Request {
+	name := command.pattern
+	if command.spec != nil {
+		name = command.spec.Name
+	}
+
+	return &Request{
+		Kind:    KindMentionCommand,
+		ID:      command.pattern,
+		Name:    name,
+		Channel: ev.Channel,
+		User:    ev.User,
+		Text:    ev.Text,
+		Mention: ev,
+	}
+}
+
+func interactionRequest(kind, id string, params map[string]string, action *slack.InteractionCallback) *Request {
+	return &Request{
+		Kind:        kind,
+		ID:          id,
+		Name:        id,
+		Params:      params,
+		TeamID:      action.Team.ID,
+		Channel:     action.Channel.ID,
+		User:        action.User.ID,
+		Interaction: action,
+	}
+}
+
+// logFields 日志里标识这次执行的字段, 再加上extra
+func (req *Request) logFields(extra Fields) Fields {
+	fields := Fields{
+		"kind":    req.Kind,
+		"command": req.Name,
+		"team":    req.TeamID,
+		"user":    req.User,
+		"channel": req.Channel,
+	}
+	if req.EventID != "" {
+		fields["event_id"] = req.EventID
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+// loggerFromContext 中间件里拿到Manager的logger
+func loggerFromContext(ctx context.Context) Logger {
+	if c := FromContext(ctx); c != nil && c.Logger != nil {
+		return c.Logger
+	}
+	return defaultLogger()
+}
+
+// Recover 把handler里的panic转成错误, 不让整个进程或者lambda挂掉
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					loggerFromContext(ctx).Error("handler panic", req.logFields(Fields{"panic": fmt.Sprint(r), "stack": string(debug.Stack())}))
+					err = errors.Errorf("panic: %v", r)
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// Logging 记录每次执行的用户, 耗时和错误. 没有权限的不算出错
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next(ctx, req)
+
+			logger := loggerFromContext(ctx)
+			if errors.Is(err, ErrDenied) {
+				// execute里已经记录并回复过
+				return err
+			}
+			if err != nil {
+				logger.Error("执行出错", req.logFields(Fields{"duration": time.Since(start), "error": err}))
+			} else {
+				logger.Info("执行完成", req.logFields(Fields{"duration": time.Since(start)}))
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"reflect"
+	"testing"
+)
+
+func TestMiddlewareOrderAndShortCircuit(t *testing.T) {
+	m := New("", "")
+
+	var trace []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, req *Request) error {
+				trace = append(trace, name+" before "+req.ID)
+				err := next(ctx, req)
+				trace = append(trace, name+" after")
+				return err
+			}
+		}
+	}
+
+	deny := func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			if req.User == "U_BAD" {
+				return errors.New("denied")
+			}
+			return next(ctx, req)
+		}
+	}
+
+	m.Use(record("outer"), record("inner"), deny)
+
+	m.RegisterMentionCommand(`<@.+> ping`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		trace = append(trace, "ping by "+RequestFromContext(ctx).User)
+	})
+
+	command, param := m.matchMentionCommand("<@B1> ping")
+
+	ev := &slackevents.AppMentionEvent{User: "U1", Text: "<@B1> ping"}
+	if err := m.execute(context.Background(), mentionRequest(ev, command), nil, func(ctx context.Context) {
+		command.process(ctx, ev, param)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"outer before <@.+> ping", "inner before <@.+> ping", "ping by U1", "inner after", "outer after"}
+	if !reflect.DeepEqual(trace, expect) {
+		t.Errorf("unexpected trace: %q", trace)
+	}
+
+	trace = nil
+	ev = &slackevents.AppMentionEvent{User: "U_BAD", Text: "<@B1> ping"}
+	if err := m.execute(context.Background(), mentionRequest(ev, command), nil, func(ctx context.Context) {
+		command.process(ctx, ev, param)
+	}); err == nil || err.Error() != "denied" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if len(trace) != 4 {
+		t.Errorf("handler should be skipped: %q", trace)
+	}
+}
+
+func TestRecoverAndReportError(t *testing.T) {
+	m := New("", "")
+
+	var observed []error
+	m.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			err := next(ctx, req)
+			observed = append(observed, err)
+			return err
+		}
+	}, Recover(), Logging())
+
+	m.RegisterBlockCallback("boom", func(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+		panic("boom")
+	})
+	m.RegisterBlockCallback("fail", func(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+		ReportError(ctx, errors.New("unity出错"))
+	})
+
+	m.dispatchInteraction(context.Background(), slack.InteractionCallback{
+		Type: slack.InteractionTypeBlockActions,
+		ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{
+			{ActionID: "boom"},
+			{ActionID: "fail"},
+		}},
+	})
+
+	if len(observed) != 2 || observed[0] == nil || observed[0].Error() != "panic: boom" || observed[1] == nil || observed[1].Error() != "unity出错" {
+		t.Errorf("unexpected errors: %v", observed)
+	}
+}
@@ -0,0 +1,123 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"sync"
+	"time"
+)
+
+// MaxOptions external select一次最多返回的选项数
+const MaxOptions = 100
+
+// OptionsProvider 给external select提供选项. query是用户已经输入的文字, 可能为空.
+// 返回error时用户看到的是空列表
+type OptionsProvider func(ctx context.Context, query string, fullCallback slack.InteractionCallback) ([]*slack.OptionBlockObject, error)
+
+// optionsResponse slack.OptionsResponse在没有选项时不输出options, 这里总是输出
+type optionsResponse struct {
+	Options []*slack.OptionBlockObject `json:"options"`
+}
+
+// CacheOptions 相同team和query的选项缓存ttl, 不用每输入一个字都调用provider. 只对options provider有效
+func CacheOptions(ttl time.Duration) registerOption {
+	return func(r *registration) {
+		r.cacheTTL = ttl
+	}
+}
+
+// RegisterOptionsProvider actionID和block callback一样可以是pattern.
+// slack里的Options Load URL设置成和Interactivity Request URL一样就行
+func (m *Manager) RegisterOptionsProvider(actionID string, provider OptionsProvider, options ...registerOption) {
+	if _, has := m.optionsProviderMap[actionID]; has {
+		panic("重复注册了options provider: " + actionID)
+	}
+	m.optionsProviderMap[actionID] = provider
+	m.addCallbackRegistration(KindBlockSuggestion, actionID, options)
+}
+
+func (m *Manager) dispatchBlockSuggestion(ctx context.Context, action slack.InteractionCallback) *optionsResponse {
+	// 每输入一个字就有一次请求, 只记debug
+	m.logger.Debug("收到block suggestion", Fields{"team": action.Team.ID, "user": action.User.ID, "action_id": action.ActionID, "query": action.Value})
+
+	response := &optionsResponse{Options: []*slack.OptionBlockObject{}}
+
+	reg, params, ok := m.route(KindBlockSuggestion, action.ActionID)
+	if !ok {
+		m.warnUnrouted(KindBlockSuggestion, action.ActionID, &action)
+		return response
+	}
+
+	registration := m.findCallbackRegistration(KindBlockSuggestion, reg)
+	// pattern的参数不同选项也不同, 用实际的action id
+	key := action.Team.ID + "\x00" + action.ActionID + "\x00" + action.Value
+	if registration.cacheTTL > 0 {
+		if cached, ok := m.optionsCache.get(key); ok {
+			response.Options = cached
+			return response
+		}
+	}
+
+	provider := m.optionsProviderMap[reg]
+	m.execute(ctx, interactionRequest(KindBlockSuggestion, reg, params, &action), registration, func(ctx context.Context) {
+		options, err := provider(ctx, action.Value, action)
+		if err != nil {
+			m.logger.Warn("获取选项失败", Fields{"action_id": action.ActionID, "query": action.Value, "error": err})
+			return
+		}
+
+		if len(options) > MaxOptions {
+			m.logger.Warn("选项太多, 只返回前面的", Fields{"action_id": action.ActionID, "count": len(options), "max": MaxOptions})
+			options = options[:MaxOptions]
+		}
+
+		if registration.cacheTTL > 0 {
+			m.optionsCache.set(key, options, registration.cacheTTL)
+		}
+		if options != nil {
+			response.Options = options
+		}
+	})
+
+	return response
+}
+
+type cachedOptions struct {
+	options []*slack.OptionBlockObject
+	expire  time.Time
+}
+
+type optionsCache struct {
+	lock    sync.Mutex
+	entries map[string]cachedOptions
+}
+
+func (c *optionsCache) get(key string) ([]*slack.OptionBlockObject, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached, has := c.entries[key]
+	if !has || time.Now().After(cached.expire) {
+		return nil, false
+	}
+	return cached.options, true
+}
+
+func (c *optionsCache) set(key string, options []*slack.OptionBlockObject, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedOptions)
+	}
+
+	// 用户的输入各不相同, 写入时顺便清理过期的
+	for k, cached := range c.entries {
+		if now.After(cached.expire) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = cachedOptions{options: options, expire: now.Add(ttl)}
+}
@@ -0,0 +1,88 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func suggest(t *testing.T, m *Manager, actionID, query string) []string {
+	w := postInteraction(m, `{"type":"block_suggestion","token":"verify","team":{"id":"T1"},"user":{"id":"U1"},
+		"action_id":"`+actionID+`","block_id":"tag","value":"`+query+`"}`)
+
+	var resp struct {
+		Options []*slack.OptionBlockObject `json:"options"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Options == nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+
+	var values []string
+	for _, option := range resp.Options {
+		values = append(values, option.Value)
+	}
+	return values
+}
+
+func TestOptionsProvider(t *testing.T) {
+	m := New("", "verify")
+
+	targets := []string{"ios-beta", "ios-release", "android-beta"}
+	m.RegisterOptionsProvider("target", func(ctx context.Context, query string, fullCallback slack.InteractionCallback) ([]*slack.OptionBlockObject, error) {
+		var result []*slack.OptionBlockObject
+		for _, target := range targets {
+			if strings.Contains(target, query) {
+				result = append(result, Option(target, target))
+			}
+		}
+		return result, nil
+	})
+
+	m.RegisterOptionsProvider("many", func(ctx context.Context, query string, fullCallback slack.InteractionCallback) ([]*slack.OptionBlockObject, error) {
+		var result []*slack.OptionBlockObject
+		for i := 0; i < MaxOptions+10; i++ {
+			result = append(result, Option(fmt.Sprint(i), fmt.Sprint(i)))
+		}
+		return result, nil
+	})
+
+	if got := suggest(t, m, "target", "ios"); strings.Join(got, ",") != "ios-beta,ios-release" {
+		t.Errorf("unexpected options: %q", got)
+	}
+	if got := suggest(t, m, "target", "web"); len(got) != 0 {
+		t.Errorf("unexpected options: %q", got)
+	}
+	if got := suggest(t, m, "many", ""); len(got) != MaxOptions {
+		t.Errorf("expect %d options, got %d", MaxOptions, len(got))
+	}
+	if got := suggest(t, m, "unknown", ""); len(got) != 0 {
+		t.Errorf("unexpected options: %q", got)
+	}
+}
+
+func TestOptionsProviderCache(t *testing.T) {
+	m := New("", "verify")
+
+	calls := 0
+	m.RegisterOptionsProvider("target:{platform}", func(ctx context.Context, query string, fullCallback slack.InteractionCallback) ([]*slack.OptionBlockObject, error) {
+		calls++
+		return []*slack.OptionBlockObject{Option(FromContext(ctx).Params["platform"]+"-"+query, query)}, nil
+	}, CacheOptions(time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if got := suggest(t, m, "target:ios", "beta"); strings.Join(got, ",") != "ios-beta" {
+			t.Errorf("unexpected options: %q", got)
+		}
+	}
+	if got := suggest(t, m, "target:android", "beta"); strings.Join(got, ",") != "android-beta" {
+		t.Errorf("unexpected options: %q", got)
+	}
+
+	if calls != 2 {
+		t.Errorf("expect 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,217 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Policy 命令和回调的权限. deny优先于allow. 设置了allow的users和usergroups时, 必须属于其中之一;
+// 设置了allow_channels时, 只能在这些channel里使用
+type Policy struct {
+	AllowUsers      []string `yaml:"allow_users"`
+	DenyUsers       []string `yaml:"deny_users"`
+	AllowUserGroups []string `yaml:"allow_usergroups"`
+	DenyUserGroups  []string `yaml:"deny_usergroups"`
+	AllowChannels   []string `yaml:"allow_channels"`
+	DenyChannels    []string `yaml:"deny_channels"`
+}
+
+// Policies key是命令名, slash command或者callback id
+type Policies map[string]*Policy
+
+const userGroupsCacheTTL = 5 * time.Minute
+
+// ErrDenied 权限检查没有通过. execute已经回复过本人, 中间件用errors.Is(err, ErrDenied)判断, 不要再回复
+var ErrDenied = errors.New("没有权限")
+
+// deniedError 回复给用户的是翻译后的原因, errors.Is判断是ErrDenied
+type deniedError struct {
+	reason error
+}
+
+func denied(format string, args ...interface{}) error {
+	return &deniedError{reason: NewLocalizedError(format, args...)}
+}
+
+func (e *deniedError) Error() string { return e.reason.Error() }
+
+func (e *deniedError) Is(target error) bool { return target == ErrDenied }
+
+func (e *deniedError) Unwrap() error { return e.reason }
+
+// userGroupCache usergroup handle到成员的缓存, 避免每次都调用usergroups.list
+type userGroupCache struct {
+	sync.Mutex
+
+	members map[string]map[string]bool
+	expire  time.Time
+}
+
+// WithPolicy 给命令或者回调设置权限, 优先于WithPolicies里的配置
+func WithPolicy(policy *Policy) registerOption {
+	return func(r *registration) {
+		r.policy = policy
+	}
+}
+
+// WithPolicies 按名字给命令和回调设置权限, 一般由LoadPolicies从yaml读取
+func WithPolicies(policies Policies) option {
+	return func(manager *Manager) {
+		manager.policies = policies
+	}
+}
+
+// LoadPolicies 从yaml读取权限配置:
+//
+//	build:
+//	  allow_usergroups: [qa, dev]
+//	  deny_channels: [C0123456]
+//	cancel_build:
+//	  allow_users: [U0123456]
+func LoadPolicies(path string) (Policies, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取权限配置失败")
+	}
+
+	result := Policies{}
+	if err := yaml.UnmarshalStrict(data, &result); err != nil {
+		return nil, errors.Wrap(err, "解析权限配置失败")
+	}
+
+	return result, nil
+}
+
+// authorize 检查req能否执行, 不能时返回给用户看的原因, errors.Is(err, ErrDenied)为true. 获取usergroups失败时返回其它错误
+func (m *Manager) authorize(ctx context.Context, req *Request, reg *registration) error {
+	var policy *Policy
+	if reg != nil {
+		policy = reg.policy
+	}
+	if policy == nil {
+		policy = m.policies[req.Name]
+	}
+	if policy == nil {
+		return nil
+	}
+
+	if contains(policy.DenyChannels, req.Channel) {
+		return denied("%s不能在这个channel使用", req.Name)
+	}
+
+	if len(policy.AllowChannels) > 0 && !contains(policy.AllowChannels, req.Channel) {
+		return denied("%s不能在这个channel使用", req.Name)
+	}
+
+	if contains(policy.DenyUsers, req.User) {
+		return denied("你没有权限使用%s", req.Name)
+	}
+
+	if len(policy.DenyUserGroups) > 0 {
+		in, err := m.inUserGroups(ctx, req.User, policy.DenyUserGroups)
+		if err != nil {
+			return err
+		}
+		if in {
+			return denied("你没有权限使用%s", req.Name)
+		}
+	}
+
+	if len(policy.AllowUsers) == 0 && len(policy.AllowUserGroups) == 0 {
+		return nil
+	}
+
+	if contains(policy.AllowUsers, req.User) {
+		return nil
+	}
+
+	if len(policy.AllowUserGroups) > 0 {
+		in, err := m.inUserGroups(ctx, req.User, policy.AllowUserGroups)
+		if err != nil {
+			return err
+		}
+		if in {
+			return nil
+		}
+	}
+
+	return denied("你没有权限使用%s", req.Name)
+}
+
+// Authorize 一个handler里有几种操作时, 按名字再检查一次权限, 比如 /ucb build 和 /ucb install.
+// 没有权限时已经回复过本人, 返回的错误errors.Is(err, ErrDenied)为true
+func (c *Context) Authorize(name string) error {
+	req := &Request{Name: name, TeamID: c.TeamID, Channel: c.Channel, User: c.User}
+	if r := RequestFromContext(c); r != nil {
+		req.Kind = r.Kind
+	}
+
+	err := c.manager.authorize(c, req, nil)
+	if errors.Is(err, ErrDenied) {
+		c.manager.replyDenied(c, req, err)
+	}
+	return err
+}
+
+// inUserGroups user是否属于任意一个handle的usergroup
+func (m *Manager) inUserGroups(ctx context.Context, user string, handles []string) (bool, error) {
+	c := &m.userGroups
+	c.Lock()
+	defer c.Unlock()
+
+	if c.members == nil || time.Now().After(c.expire) {
+		groups, err := m.slackApi.GetUserGroupsContext(ctx, slack.GetUserGroupsOptionIncludeUsers(true))
+		if err != nil {
+			return false, errors.Wrap(err, "获取usergroups失败, 无法检查权限")
+		}
+
+		c.members = make(map[string]map[string]bool)
+		for _, g := range groups {
+			users := make(map[string]bool)
+			for _, u := range g.Users {
+				users[u] = true
+			}
+			c.members[g.Handle] = users
+		}
+		c.expire = time.Now().Add(userGroupsCacheTTL)
+	}
+
+	for _, handle := range handles {
+		if c.members[handle][user] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// replyDenied 权限不足时只回复给本人. view submission在response里提示, 见deniedViewResponse.
+// Home tab之类没有channel的交互私信给本人, 不能让用户点了没反应
+func (m *Manager) replyDenied(ctx context.Context, req *Request, err error) {
+	m.logger.Info("没有权限", Fields{"kind": req.Kind, "command": req.Name, "team": req.TeamID, "user": req.User, "channel": req.Channel, "error": err})
+
+	if req.User == "" || req.Kind == KindViewSubmission {
+		return
+	}
+
+	msg := slack.MsgOptionText(m.ErrorText(m.Locale(ctx, req.TeamID, req.User), err), false)
+	if req.Channel == "" {
+		m.slackApi.PostMessageContext(ctx, req.User, msg)
+		return
+	}
+	m.slackApi.PostEphemeralContext(ctx, req.Channel, req.User, msg)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
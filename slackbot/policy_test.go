@@ -0,0 +1,197 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	var listCalls int
+	var denied []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/usergroups.list", func(w http.ResponseWriter, r *http.Request) {
+		listCalls++
+		w.Write([]byte(`{"ok":true,"usergroups":[{"id":"S1","handle":"qa","users":["U_QA"]},{"id":"S2","handle":"intern","users":["U_INTERN"]}]}`))
+	})
+	mux.HandleFunc("/chat.postEphemeral", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		denied = append(denied, r.FormValue("user"))
+		w.Write([]byte(`{"ok":true}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(server.URL+"/")), WithPolicies(Policies{
+		"build": {
+			AllowUsers:      []string{"U_ADMIN"},
+			AllowUserGroups: []string{"qa"},
+			DenyUserGroups:  []string{"intern"},
+			DenyChannels:    []string{"C_GENERAL"},
+		},
+	}))
+
+	override := &Policy{AllowChannels: []string{"C_OPS"}}
+	m.RegisterSlashCommand("/deploy", func(ctx context.Context, s *slack.SlashCommand) {}, WithPolicy(override))
+
+	cases := []struct {
+		name, user, channel string
+		reg                 *registration
+		allowed             bool
+	}{
+		{"build", "U_ADMIN", "C_OPS", nil, true},
+		{"build", "U_QA", "C_OPS", nil, true},
+		{"build", "U_OTHER", "C_OPS", nil, false},
+		{"build", "U_INTERN", "C_OPS", nil, false},
+		{"build", "U_ADMIN", "C_GENERAL", nil, false},
+		{"ping", "U_OTHER", "C_GENERAL", nil, true},
+		{"/deploy", "U_OTHER", "C_OPS", m.findCallbackRegistration(KindSlashCommand, "/deploy"), true},
+		{"/deploy", "U_ADMIN", "C_GENERAL", m.findCallbackRegistration(KindSlashCommand, "/deploy"), false},
+	}
+
+	for _, c := range cases {
+		req := &Request{Name: c.name, User: c.user, Channel: c.channel}
+		ran := false
+		err := m.execute(context.Background(), req, c.reg, func(ctx context.Context) {
+			ran = true
+		})
+
+		if ran != c.allowed || (err == nil) != c.allowed {
+			t.Errorf("%s by %s in %s: ran %v, err %v", c.name, c.user, c.channel, ran, err)
+		}
+		if !c.allowed && !errors.Is(err, ErrDenied) {
+			t.Errorf("%s by %s in %s: should be ErrDenied, got %v", c.name, c.user, c.channel, err)
+		}
+	}
+
+	if listCalls != 1 {
+		t.Errorf("usergroups should be cached, got %d calls", listCalls)
+	}
+
+	if len(denied) != 4 {
+		t.Errorf("denied users should be replied: %q", denied)
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.yaml")
+	ioutil.WriteFile(path, []byte("build:\n  allow_usergroups: [qa, dev]\n  deny_channels: [C0123456]\n"), 0644)
+
+	policies, err := LoadPolicies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := policies["build"]
+	if build == nil || len(build.AllowUserGroups) != 2 || build.DenyChannels[0] != "C0123456" {
+		t.Errorf("unexpected policies: %+v", build)
+	}
+
+	ioutil.WriteFile(path, []byte("build:\n  allow_group: [qa]\n"), 0644)
+	if _, err := LoadPolicies(path); err == nil {
+		t.Error("unknown fields should be rejected")
+	}
+}
+
+func TestPolicyName(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")), WithPolicies(Policies{
+		"deploy": {AllowUsers: []string{"U_ADMIN"}},
+	}))
+
+	var ran []string
+	process := func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		ran = append(ran, cmd[0])
+	}
+	// usage只是help里的文字, 改了也不影响权限
+	m.RegisterMentionCommand(`<@.+> deploy now`, process, Usage("deploy now"))
+	m.RegisterMentionCommand(`<@.+> deploy later`, process, Name("deploy"))
+
+	for _, text := range []string{"<@B1> deploy now", "<@B1> deploy later"} {
+		command, param := m.matchMentionCommand(text)
+		ev := &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: text}
+		m.execute(context.Background(), mentionRequest(ev, command), &command.registration, func(ctx context.Context) {
+			command.process(ctx, ev, param)
+		})
+	}
+
+	if !reflect.DeepEqual(ran, []string{"<@B1> deploy now"}) {
+		t.Errorf("unexpected runs: %q", ran)
+	}
+
+	c := m.newContext(context.Background(), &Request{User: "U1", Channel: "C1"})
+	if err := c.Authorize("deploy"); !errors.Is(err, ErrDenied) {
+		t.Errorf("should be denied: %v", err)
+	}
+	if err := c.Authorize("ping"); err != nil {
+		t.Error(err)
+	}
+
+	if calls := api.takeCalls(); len(calls) != 2 {
+		t.Errorf("denied users should be replied once each: %q", calls)
+	}
+}
+
+func TestPolicyWithoutChannel(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")), WithPolicies(Policies{
+		"build": {AllowChannels: []string{"C_OPS"}},
+	}))
+
+	var ran []string
+	m.RegisterViewSubmission("launcher", func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback) *slack.ViewSubmissionResponse {
+		ran = append(ran, "launcher "+FromContext(ctx).Channel)
+		return nil
+	}, Name("build"), MetadataChannel())
+	m.RegisterBlockCallback("home_build", func(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+		ran = append(ran, "home")
+	}, Name("build"))
+
+	submit := func(channel string) interface{} {
+		var action slack.InteractionCallback
+		json.Unmarshal([]byte(`{"type":"view_submission","user":{"id":"U1"},"view":{"callback_id":"launcher","private_metadata":"`+channel+`","title":{"type":"plain_text","text":"新建构建"}}}`), &action)
+		return m.dispatchInteraction(context.Background(), action)
+	}
+
+	if response := submit("C_OPS"); response != nil {
+		t.Errorf("allowed submission should close the modal: %+v", response)
+	}
+
+	// 没有权限时modal换成原因, 不能直接关掉
+	response, ok := submit("C_GENERAL").(*slack.ViewSubmissionResponse)
+	if !ok || response.ResponseAction != slack.RAUpdate || response.View.Title.Text != "新建构建" {
+		t.Errorf("denied submission should update the modal: %+v", response)
+	}
+
+	// Home tab上的按钮没有channel, 私信告诉用户
+	var action slack.InteractionCallback
+	json.Unmarshal([]byte(`{"type":"block_actions","user":{"id":"U1"},"actions":[{"action_id":"home_build","block_id":"b"}]}`), &action)
+	m.dispatchInteraction(context.Background(), action)
+
+	if !reflect.DeepEqual(ran, []string{"launcher C_OPS"}) {
+		t.Errorf("unexpected runs: %q", ran)
+	}
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, []string{"/chat.postMessage channel=U1"}) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
@@ -0,0 +1,78 @@
+package slackbot
+
+import (
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+// idPattern 回调的callback id或者action id里带参数, 比如 cancel_build:{build}:{target}
+type idPattern struct {
+	reg   *regexp.Regexp
+	names []string
+}
+
+var idParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// compileIDPattern id里没有{name}时返回nil, 只能完全匹配.
+// 参数尽量少匹配, 最后一个参数匹配剩下的部分, 所以可能包含分隔符的参数放在最后
+func compileIDPattern(id string) *idPattern {
+	if !strings.Contains(id, "{") {
+		return nil
+	}
+
+	result := &idPattern{}
+	expr := "^"
+	last := 0
+	for _, loc := range idParam.FindAllStringSubmatchIndex(id, -1) {
+		expr += regexp.QuoteMeta(id[last:loc[0]]) + "(.+?)"
+		result.names = append(result.names, id[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(id[last:]) + "$"
+
+	if len(result.names) == 0 {
+		panic("callback id的参数格式是{name}: " + id)
+	}
+
+	result.reg = regexp.MustCompile(expr)
+	return result
+}
+
+func (p *idPattern) match(id string) (map[string]string, bool) {
+	match := p.reg.FindStringSubmatch(id)
+	if match == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(p.names))
+	for i, name := range p.names {
+		params[name] = match[i+1]
+	}
+	return params, true
+}
+
+// route 找到id对应的注册. 完全匹配优先, 然后按注册顺序匹配pattern
+func (m *Manager) route(kind, id string) (reg string, params map[string]string, ok bool) {
+	for _, c := range m.callbacks {
+		if c.kind == kind && c.id == id {
+			return c.id, nil, true
+		}
+	}
+
+	for _, c := range m.callbacks {
+		if c.kind != kind || c.pattern == nil {
+			continue
+		}
+		if params, ok := c.pattern.match(id); ok {
+			return c.id, params, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// warnUnrouted 收到了没有注册的id, 一般是按钮的action id写错了, 或者忘了注册
+func (m *Manager) warnUnrouted(kind, id string, action *slack.InteractionCallback) {
+	m.logger.Warn("没有匹配的回调", Fields{"kind": kind, "id": id, "team": action.Team.ID, "user": action.User.ID, "channel": action.Channel.ID})
+}
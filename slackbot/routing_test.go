@@ -0,0 +1,88 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+func TestIDPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		id      string
+		params  map[string]string
+	}{
+		{"cancel_build:{target}:{build}", "cancel_build:ios:42", map[string]string{"target": "ios", "build": "42"}},
+		{"cancel_build:{build}:{target}", "cancel_build:42:ios:beta", map[string]string{"build": "42", "target": "ios:beta"}},
+		{"build.{id}", "build.1.2", map[string]string{"id": "1.2"}},
+		{"cancel_build:{target}:{build}", "cancel_build:ios", nil},
+		{"cancel_build:{target}", "cancel_build:", nil},
+		{"cancel_build:{target}", "xcancel_build:ios", nil},
+	}
+
+	for _, test := range tests {
+		params, _ := compileIDPattern(test.pattern).match(test.id)
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s %s: expect %v, got %v", test.pattern, test.id, test.params, params)
+		}
+	}
+
+	if compileIDPattern("cancel_build") != nil {
+		t.Error("id without params should not be a pattern")
+	}
+}
+
+func TestRouteBlockAction(t *testing.T) {
+	logger := &recordLogger{}
+	m := New("", "", WithLogger(logger))
+
+	var calls []string
+	handler := func(name string) BlockCallback {
+		return func(ctx context.Context, action *slack.BlockAction, callback slack.InteractionCallback) {
+			c := FromContext(ctx)
+			calls = append(calls, name+" "+RequestFromContext(ctx).ID+" "+c.Params["target"]+" "+c.Params["build"])
+		}
+	}
+	m.RegisterBlockCallback("cancel_build:{target}:{build}", handler("pattern"))
+	m.RegisterBlockCallback("cancel_build:all:all", handler("exact"))
+
+	m.RegisterViewSubmission("launcher:{target}", func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback) *slack.ViewSubmissionResponse {
+		calls = append(calls, "view "+FromContext(ctx).Params["target"])
+		return nil
+	})
+
+	var action slack.InteractionCallback
+	json.Unmarshal([]byte(`{"type":"block_actions","team":{"id":"T1"},"user":{"id":"U1"},"actions":[
+		{"action_id":"cancel_build:ios:42","block_id":"b"},
+		{"action_id":"cancel_build:all:all","block_id":"b"},
+		{"action_id":"retry_build:ios:42","block_id":"b"}
+	]}`), &action)
+	m.dispatchInteraction(context.Background(), action)
+
+	json.Unmarshal([]byte(`{"type":"view_submission","user":{"id":"U1"},"view":{"callback_id":"launcher:android"}}`), &action)
+	m.dispatchInteraction(context.Background(), action)
+
+	expect := []string{
+		"pattern cancel_build:{target}:{build} ios 42",
+		"exact cancel_build:all:all  ",
+		"view android",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+
+	warned := false
+	for i, entry := range logger.entries {
+		if entry == "warn 没有匹配的回调" {
+			warned = true
+			if fields := logger.fields[i]; fields["id"] != "retry_build:ios:42" || fields["kind"] != KindBlockCallback || fields["team"] != "T1" {
+				t.Errorf("unexpected fields: %v", fields)
+			}
+		}
+	}
+	if !warned {
+		t.Errorf("unrouted action id not warned: %q", logger.entries)
+	}
+}
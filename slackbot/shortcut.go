@@ -0,0 +1,59 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+)
+
+// GlobalShortcut 从快捷方式菜单或者搜索框触发, 没有channel. triggerID用来打开modal, 3秒内有效
+type GlobalShortcut func(ctx context.Context, triggerID string, fullCallback slack.InteractionCallback)
+
+// MessageShortcut 从消息的更多操作菜单触发, message是被操作的消息
+type MessageShortcut func(ctx context.Context, triggerID string, message *slack.Message, fullCallback slack.InteractionCallback)
+
+// RegisterGlobalShortcut callbackID是slack app设置里shortcut的Callback ID, 和block callback一样可以是pattern
+func (m *Manager) RegisterGlobalShortcut(callbackID string, shortcut GlobalShortcut, options ...registerOption) {
+	if _, has := m.globalShortcutMap[callbackID]; has {
+		panic("重复注册了global shortcut: " + callbackID)
+	}
+	m.globalShortcutMap[callbackID] = shortcut
+	m.addCallbackRegistration(KindGlobalShortcut, callbackID, options)
+}
+
+func (m *Manager) RegisterMessageShortcut(callbackID string, shortcut MessageShortcut, options ...registerOption) {
+	if _, has := m.messageShortcutMap[callbackID]; has {
+		panic("重复注册了message shortcut: " + callbackID)
+	}
+	m.messageShortcutMap[callbackID] = shortcut
+	m.addCallbackRegistration(KindMessageShortcut, callbackID, options)
+}
+
+func (m *Manager) dispatchShortcut(ctx context.Context, action slack.InteractionCallback) {
+	kind := KindGlobalShortcut
+	if action.Type == slack.InteractionTypeMessageAction {
+		kind = KindMessageShortcut
+	}
+
+	m.logger.Info("收到shortcut", Fields{"kind": kind, "team": action.Team.ID, "user": action.User.ID, "callback_id": action.CallbackID})
+
+	reg, params, ok := m.route(kind, action.CallbackID)
+	if !ok {
+		m.warnUnrouted(kind, action.CallbackID, &action)
+		return
+	}
+
+	var process func(ctx context.Context)
+	if kind == KindGlobalShortcut {
+		shortcut := m.globalShortcutMap[reg]
+		process = func(ctx context.Context) {
+			shortcut(ctx, action.TriggerID, action)
+		}
+	} else {
+		shortcut := m.messageShortcutMap[reg]
+		process = func(ctx context.Context) {
+			shortcut(ctx, action.TriggerID, &action.Message, action)
+		}
+	}
+
+	m.schedule(ctx, interactionRequest(kind, reg, params, &action), m.findCallbackRegistration(kind, reg), process)
+}
@@ -0,0 +1,35 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+func TestShortcuts(t *testing.T) {
+	m := New("", "verify")
+
+	var calls []string
+	m.RegisterGlobalShortcut("new_build", func(ctx context.Context, triggerID string, fullCallback slack.InteractionCallback) {
+		calls = append(calls, "global "+triggerID+" "+RequestFromContext(ctx).Kind)
+	})
+	m.RegisterMessageShortcut("rebuild", func(ctx context.Context, triggerID string, message *slack.Message, fullCallback slack.InteractionCallback) {
+		c := FromContext(ctx)
+		calls = append(calls, "message "+triggerID+" "+c.Channel+" "+c.messageTS+" "+message.Text)
+	})
+
+	postInteraction(m, `{"type":"shortcut","token":"verify","callback_id":"new_build","trigger_id":"t1","team":{"id":"T1"},"user":{"id":"U1"}}`)
+	postInteraction(m, `{"type":"message_action","token":"verify","callback_id":"rebuild","trigger_id":"t2","team":{"id":"T1"},"user":{"id":"U1"},
+		"channel":{"id":"C1"},"message_ts":"1.0","message":{"type":"message","ts":"1.0","text":"启动成功: ios 42"}}`)
+	// callback id一样, 类型不同也不能混用
+	postInteraction(m, `{"type":"shortcut","token":"verify","callback_id":"rebuild","trigger_id":"t3","team":{"id":"T1"},"user":{"id":"U1"}}`)
+
+	expect := []string{
+		"global t1 global_shortcut",
+		"message t2 C1 1.0 启动成功: ios 42",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
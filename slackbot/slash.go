@@ -0,0 +1,75 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"net/http"
+	"strings"
+)
+
+type SlashCommand func(ctx context.Context, cmd *slack.SlashCommand)
+
+func (m *Manager) RegisterSlashCommand(command string, cmd SlashCommand, options ...registerOption) {
+	if !strings.HasPrefix(command, "/") {
+		panic("slash command必须以/开头: " + command)
+	}
+	if _, has := m.slashCommandMap[command]; has {
+		panic("重复注册了slash command: " + command)
+	}
+	m.slashCommandMap[command] = cmd
+	m.addCallbackRegistration(KindSlashCommand, command, options)
+}
+
+// ServeSlashCommand 处理slash command的请求, 对应slack里slash command的Request URL
+func (m *Manager) ServeSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if _, err := m.verifyRequest(r); err != nil {
+		m.logger.Warn("slash command请求校验失败", Fields{"error": err})
+		writeString(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	s, err := slack.SlashCommandParse(r)
+	if err != nil {
+		m.logger.Warn("解析slash command失败", Fields{"error": err})
+		writeString(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if !m.verifyToken(s.Token) {
+		m.logger.Warn("slash command的token验证失败", Fields{"team": s.TeamID, "user": s.UserID})
+		writeString(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	// 直接在response里返回的文字只有调用者自己能看到
+	writeString(w, http.StatusOK, m.dispatchSlashCommand(r.Context(), &s))
+}
+
+// dispatchSlashCommand 执行slash command, 返回需要回复给调用者的文字. http和socket mode共用
+func (m *Manager) dispatchSlashCommand(ctx context.Context, s *slack.SlashCommand) string {
+	m.logger.Info("收到slash command", Fields{"team": s.TeamID, "user": s.UserID, "channel": s.ChannelID, "command": s.Command, "text": s.Text})
+
+	process, has := m.slashCommandMap[s.Command]
+	if !has {
+		m.logger.Warn("收到未知的slash command", Fields{"command": s.Command})
+		return m.T(m.Locale(ctx, s.TeamID, s.UserID), "收到未知的命令: %s", s.Command+" "+s.Text)
+	}
+
+	s.Text = strings.TrimSpace(s.Text)
+
+	req := &Request{
+		Kind:    KindSlashCommand,
+		ID:      s.Command,
+		Name:    s.Command,
+		TeamID:  s.TeamID,
+		Channel: s.ChannelID,
+		User:    s.UserID,
+		Text:    s.Text,
+		Slash:   s,
+	}
+
+	m.schedule(ctx, req, m.findCallbackRegistration(KindSlashCommand, s.Command), func(ctx context.Context) {
+		process(ctx, s)
+	})
+	return ""
+}
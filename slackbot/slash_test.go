@@ -0,0 +1,74 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func postSlashCommand(m *Manager, form url.Values) *httptest.ResponseRecorder {
+	r := m.Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSlashCommand(t *testing.T) {
+	m := New("", "verify")
+
+	var got *slack.SlashCommand
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		got = cmd
+	})
+
+	w := postSlashCommand(m, url.Values{
+		"token":        {"verify"},
+		"command":      {"/ucb"},
+		"text":         {" build ios "},
+		"user_id":      {"U1"},
+		"channel_id":   {"C1"},
+		"response_url": {"https://hooks.slack.com/commands/1"},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: %d", w.Code)
+	}
+
+	if got == nil {
+		t.Fatal("handler not called")
+	}
+
+	if got.Text != "build ios" || got.UserID != "U1" || got.ChannelID != "C1" || got.ResponseURL != "https://hooks.slack.com/commands/1" {
+		t.Errorf("unexpected command: %+v", got)
+	}
+}
+
+func TestSlashCommandBadToken(t *testing.T) {
+	m := New("", "verify")
+
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		t.Error("should not be called")
+	})
+
+	w := postSlashCommand(m, url.Values{"token": {"wrong"}, "command": {"/ucb"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status: %d", w.Code)
+	}
+}
+
+func TestSlashCommandUnknown(t *testing.T) {
+	m := New("", "verify")
+
+	w := postSlashCommand(m, url.Values{"token": {"verify"}, "command": {"/nope"}, "text": {"x"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/nope") {
+		t.Errorf("status: %d body: %s", w.Code, w.Body.String())
+	}
+}
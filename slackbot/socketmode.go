@@ -0,0 +1,197 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	socketModeHello         = "hello"
+	socketModeDisconnect    = "disconnect"
+	socketModeEventsAPI     = "events_api"
+	socketModeInteractive   = "interactive"
+	socketModeSlashCommands = "slash_commands"
+
+	socketModeMinReconnectDelay = time.Second
+	socketModeMaxReconnectDelay = 30 * time.Second
+)
+
+type socketModeEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+
+	RetryAttempt int    `json:"retry_attempt"`
+	RetryReason  string `json:"retry_reason"`
+}
+
+type socketModeAck struct {
+	EnvelopeID string      `json:"envelope_id"`
+	Payload    interface{} `json:"payload,omitempty"`
+}
+
+// RunSocketMode 通过Socket Mode接收事件, 不需要slack能访问到/message和/interact.
+// 事件和http handler走同样的command和callback分发. 断线会自动重连, 直到ctx结束才返回
+func (m *Manager) RunSocketMode(ctx context.Context, appToken string) error {
+	api := slack.New(m.slackToken, append(m.slackOptions, slack.OptionAppLevelToken(appToken))...)
+
+	delay := socketModeMinReconnectDelay
+	for {
+		connected, err := m.runSocketModeConnection(ctx, api)
+		if err != nil {
+			m.logger.Warn("socket mode连接断开", Fields{"error": err})
+		}
+
+		if connected {
+			delay = socketModeMinReconnectDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if !connected && delay < socketModeMaxReconnectDelay {
+			delay *= 2
+		}
+	}
+}
+
+// runSocketModeConnection 建立一个连接并一直读取到断开. 返回是否曾经连接成功
+func (m *Manager) runSocketModeConnection(ctx context.Context, api *slack.Client) (bool, error) {
+	_, url, err := api.StartSocketModeContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "apps.connections.open失败")
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "连接websocket失败")
+	}
+	defer conn.Close()
+
+	// ctx结束时关掉连接, 让阻塞中的ReadJSON返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		var envelope socketModeEnvelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return true, errors.Wrap(err, "读取socket mode消息失败")
+		}
+
+		switch envelope.Type {
+		case socketModeHello:
+			m.logger.Info("socket mode已连接", nil)
+			continue
+
+		case socketModeDisconnect:
+			m.logger.Info("socket mode要求断开重连", Fields{"reason": envelope.Reason})
+			return true, nil
+		}
+
+		ack, process := m.handleSocketModeEnvelopeRecovered(ctx, &envelope)
+
+		if envelope.EnvelopeID != "" {
+			if err := conn.WriteJSON(ack); err != nil {
+				return true, errors.Wrap(err, "回复ack失败")
+			}
+		}
+
+		if process != nil {
+			envelope := envelope
+			go func() {
+				defer m.recoverSocketMode(&envelope)
+				process()
+			}()
+		}
+	}
+}
+
+// recoverSocketMode socket mode没有http server的recover兜底, 和schedule一样只记录panic, 不让整个bot挂掉
+func (m *Manager) recoverSocketMode(envelope *socketModeEnvelope) {
+	if r := recover(); r != nil {
+		m.logger.Error("handler panic", Fields{"envelope_type": envelope.Type, "envelope_id": envelope.EnvelopeID, "panic": fmt.Sprint(r), "stack": string(debug.Stack())})
+	}
+}
+
+// handleSocketModeEnvelopeRecovered view_submission和slash command在读消息的goroutine里同步执行, panic时照样ack
+func (m *Manager) handleSocketModeEnvelopeRecovered(ctx context.Context, envelope *socketModeEnvelope) (ack *socketModeAck, process func()) {
+	ack = &socketModeAck{EnvelopeID: envelope.EnvelopeID}
+	defer m.recoverSocketMode(envelope)
+
+	return m.handleSocketModeEnvelope(ctx, envelope)
+}
+
+// handleSocketModeEnvelope 解析envelope, 返回要回复的ack和ack之后再执行的处理函数
+func (m *Manager) handleSocketModeEnvelope(ctx context.Context, envelope *socketModeEnvelope) (*socketModeAck, func()) {
+	ack := &socketModeAck{EnvelopeID: envelope.EnvelopeID}
+
+	switch envelope.Type {
+	case socketModeEventsAPI:
+		// 重试的事件event_id不变, 由dispatchEvent去重
+		if envelope.RetryAttempt > 0 {
+			m.logger.Info("收到socket mode的重试", Fields{"retry_num": envelope.RetryAttempt, "retry_reason": envelope.RetryReason})
+		}
+
+		// socket mode的连接本身已经用app token认证过了, 不需要再校验token
+		eventsAPIEvent, err := m.parseEvent(envelope.Payload, false)
+		if err != nil {
+			m.logger.Warn("socket mode event解析失败", Fields{"error": err})
+			return ack, nil
+		}
+
+		return ack, func() {
+			m.dispatchEvent(ctx, eventsAPIEvent)
+		}
+
+	case socketModeInteractive:
+		var action slack.InteractionCallback
+		if err := json.Unmarshal(envelope.Payload, &action); err != nil {
+			m.logger.Warn("socket mode interactive解析失败", Fields{"error": err})
+			return ack, nil
+		}
+
+		// view_submission的response_action和block_suggestion的选项要放在ack里, 只能先执行完再ack
+		if action.Type == slack.InteractionTypeViewSubmission || action.Type == slack.InteractionTypeBlockSuggestion {
+			ack.Payload = m.dispatchInteraction(ctx, action)
+			return ack, nil
+		}
+
+		return ack, func() {
+			m.dispatchInteraction(ctx, action)
+		}
+
+	case socketModeSlashCommands:
+		var s slack.SlashCommand
+		if err := json.Unmarshal(envelope.Payload, &s); err != nil {
+			m.logger.Warn("socket mode slash command解析失败", Fields{"error": err})
+			return ack, nil
+		}
+
+		// 和http一样, 执行完再把回复放在ack里
+		if reply := m.dispatchSlashCommand(ctx, &s); reply != "" {
+			ack.Payload = map[string]string{"text": reply}
+		}
+		return ack, nil
+
+	default:
+		m.logger.Warn("收到未知的socket mode消息", Fields{"type": envelope.Type})
+		return ack, nil
+	}
+}
@@ -0,0 +1,213 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSocketModeServer 模拟apps.connections.open和socket mode的websocket
+type fakeSocketModeServer struct {
+	*httptest.Server
+
+	send chan interface{}
+	acks chan socketModeAck
+}
+
+func newFakeSocketModeServer(t *testing.T) *fakeSocketModeServer {
+	f := &fakeSocketModeServer{
+		send: make(chan interface{}, 10),
+		acks: make(chan socketModeAck, 10),
+	}
+
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xapp-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"ok":true,"url":"ws://%s/link"}`, r.Host)
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(map[string]string{"type": socketModeHello})
+
+		go func() {
+			for {
+				var ack socketModeAck
+				if err := conn.ReadJSON(&ack); err != nil {
+					return
+				}
+				f.acks <- ack
+			}
+		}()
+
+		for msg := range f.send {
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	})
+
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeSocketModeServer) Close() {
+	close(f.send)
+	f.Server.Close()
+}
+
+func (f *fakeSocketModeServer) waitAck(t *testing.T) socketModeAck {
+	select {
+	case ack := <-f.acks:
+		return ack
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting ack")
+	}
+	return socketModeAck{}
+}
+
+func TestSocketMode(t *testing.T) {
+	server := newFakeSocketModeServer(t)
+	defer server.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(server.URL+"/")))
+
+	mentions := make(chan []string, 1)
+	m.RegisterMentionCommand(`<@.+> build (\S+)`, func(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
+		mentions <- cmd
+	})
+
+	interactions := make(chan string, 1)
+	m.RegisterBlockCallback("cancel", func(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+		interactions <- action.Value
+	})
+
+	m.RegisterSlashCommand("/panic", func(ctx context.Context, cmd *slack.SlashCommand) {
+		panic("boom")
+	})
+	m.RegisterBlockCallback("panic", func(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- m.RunSocketMode(ctx, "xapp-test")
+	}()
+
+	server.send <- map[string]interface{}{
+		"envelope_id": "e1",
+		"type":        socketModeEventsAPI,
+		"payload": json.RawMessage(`{"type":"event_callback","team_id":"T1","event_id":"Ev1",
+			"event":{"type":"app_mention","user":"U1","text":"<@B1> build ios","ts":"1.1","channel":"C1","event_ts":"1.1"}}`),
+	}
+
+	if ack := server.waitAck(t); ack.EnvelopeID != "e1" {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+
+	select {
+	case cmd := <-mentions:
+		if cmd[1] != "ios" {
+			t.Errorf("unexpected cmd: %v", cmd)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("mention command not called")
+	}
+
+	server.send <- map[string]interface{}{
+		"envelope_id": "e2",
+		"type":        socketModeInteractive,
+		"payload": json.RawMessage(`{"type":"block_actions","trigger_id":"t1","user":{"id":"U1"},
+			"actions":[{"block_id":"b1","action_id":"cancel","value":"12_ios","type":"button"}]}`),
+	}
+
+	if ack := server.waitAck(t); ack.EnvelopeID != "e2" {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+
+	select {
+	case value := <-interactions:
+		if value != "12_ios" {
+			t.Errorf("unexpected value: %s", value)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("block callback not called")
+	}
+
+	server.send <- map[string]interface{}{
+		"envelope_id": "e3",
+		"type":        socketModeSlashCommands,
+		"payload":     map[string]string{"command": "/nope", "text": "x", "user_id": "U1", "channel_id": "C1"},
+	}
+
+	ack := server.waitAck(t)
+	if b, _ := json.Marshal(ack.Payload); ack.EnvelopeID != "e3" || !strings.Contains(string(b), "/nope") {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+
+	// handler的panic不能让整个bot挂掉, 同步和后台执行的都一样
+	server.send <- map[string]interface{}{
+		"envelope_id": "e4",
+		"type":        socketModeSlashCommands,
+		"payload":     map[string]string{"command": "/panic", "user_id": "U1", "channel_id": "C1"},
+	}
+	if ack := server.waitAck(t); ack.EnvelopeID != "e4" {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+
+	server.send <- map[string]interface{}{
+		"envelope_id": "e5",
+		"type":        socketModeInteractive,
+		"payload": json.RawMessage(`{"type":"block_actions","trigger_id":"t1","user":{"id":"U1"},
+			"actions":[{"block_id":"b1","action_id":"panic","type":"button"}]}`),
+	}
+	if ack := server.waitAck(t); ack.EnvelopeID != "e5" {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+
+	server.send <- map[string]interface{}{
+		"envelope_id": "e6",
+		"type":        socketModeInteractive,
+		"payload": json.RawMessage(`{"type":"block_actions","trigger_id":"t1","user":{"id":"U1"},
+			"actions":[{"block_id":"b1","action_id":"cancel","value":"13_ios","type":"button"}]}`),
+	}
+	server.waitAck(t)
+	select {
+	case value := <-interactions:
+		if value != "13_ios" {
+			t.Errorf("unexpected value: %s", value)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("bot should survive handler panics")
+	}
+
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("unexpected result: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("RunSocketMode not returned after cancel")
+	}
+}
@@ -0,0 +1,137 @@
+package slackbot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateMACSize 签名截断到16字节, action_id最多255个字符, 尽量短
+const stateMACSize = 16
+
+var (
+	// ErrStateInvalid state被改过, 或者是用别的密钥签名的
+	ErrStateInvalid = NewLocalizedError("按钮的数据无效, 请重新操作")
+	// ErrStateExpired state超过了EncodeState时的ttl
+	ErrStateExpired = NewLocalizedError("操作已过期, 请重新发起")
+)
+
+// WithStateSecret EncodeState签名用的密钥, 没有设置时用signing secret, 再没有用verification token
+func WithStateSecret(secret string) option {
+	return func(manager *Manager) {
+		manager.stateSecret = secret
+	}
+}
+
+func (m *Manager) stateKey() ([]byte, error) {
+	switch {
+	case m.stateSecret != "":
+		return []byte(m.stateSecret), nil
+	case m.signingSecret != "":
+		return []byte(m.signingSecret), nil
+	case m.slackVerificationToken != "":
+		return []byte(m.slackVerificationToken), nil
+	}
+	return nil, errors.New("没有设置state的密钥, 需要WithStateSecret或者WithSigningSecret")
+}
+
+// EncodeState 把v序列化成带签名的字符串, 用在按钮的value, action_id或者view的private_metadata里, 回调时用DecodeState取回.
+// ttl为0时不过期. 数据只是签名, 没有加密, 用户能看到内容
+func (m *Manager) EncodeState(v interface{}, ttl time.Duration) (string, error) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	return m.encodeState(v, expire)
+}
+
+// encodeState 格式是 data.expire.mac, expire是36进制的unix时间, 不过期时为空
+func (m *Manager) encodeState(v interface{}, expire time.Time) (string, error) {
+	key, err := m.stateKey()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "state序列化失败")
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data) + "."
+	if !expire.IsZero() {
+		payload += strconv.FormatInt(expire.Unix(), 36)
+	}
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(stateMAC(key, payload)), nil
+}
+
+// DecodeState 校验签名和过期时间, 再解析到v里. 失败时返回ErrStateInvalid或者ErrStateExpired
+func (m *Manager) DecodeState(state string, v interface{}) error {
+	key, err := m.stateKey()
+	if err != nil {
+		return err
+	}
+
+	i := strings.LastIndex(state, ".")
+	if i < 0 {
+		return ErrStateInvalid
+	}
+	payload := state[:i]
+
+	mac, err := base64.RawURLEncoding.DecodeString(state[i+1:])
+	if err != nil || !hmac.Equal(mac, stateMAC(key, payload)) {
+		return ErrStateInvalid
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 2 {
+		return ErrStateInvalid
+	}
+
+	if parts[1] != "" {
+		expire, err := strconv.ParseInt(parts[1], 36, 64)
+		if err != nil {
+			return ErrStateInvalid
+		}
+		if time.Now().Unix() > expire {
+			return ErrStateExpired
+		}
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrStateInvalid
+	}
+	return errors.Wrap(json.Unmarshal(data, v), "state解析失败")
+}
+
+func stateMAC(key []byte, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)[:stateMACSize]
+}
+
+// EncodeState 见Manager.EncodeState
+func (c *Context) EncodeState(v interface{}, ttl time.Duration) (string, error) {
+	return c.manager.EncodeState(v, ttl)
+}
+
+// DecodeState 和Manager.DecodeState一样, 但是失败时已经回复过用户, handler直接return就行
+func (c *Context) DecodeState(state string, v interface{}) error {
+	err := c.manager.DecodeState(state, v)
+	if err == nil {
+		return nil
+	}
+
+	c.Logger.Warn("state校验失败", Fields{"team": c.TeamID, "user": c.User, "channel": c.Channel, "error": err})
+
+	if c.Channel != "" && c.User != "" {
+		c.ReplyEphemeral(c.ErrorText(err))
+	}
+	return err
+}
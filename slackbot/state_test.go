@@ -0,0 +1,100 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testState struct {
+	Build  int    `json:"b"`
+	Target string `json:"t"`
+}
+
+func TestState(t *testing.T) {
+	m := New("", "", WithStateSecret("secret"))
+
+	state, err := m.EncodeState(testState{Build: 42, Target: "ios"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state) > 255 {
+		t.Errorf("state too long for action_id: %d", len(state))
+	}
+
+	var decoded testState
+	if err := m.DecodeState(state, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, testState{Build: 42, Target: "ios"}) {
+		t.Errorf("unexpected state: %+v", decoded)
+	}
+
+	forever, _ := m.EncodeState(testState{Build: 1}, 0)
+	if err := m.DecodeState(forever, &decoded); err != nil {
+		t.Error(err)
+	}
+
+	expired, _ := m.encodeState(testState{Build: 42}, time.Now().Add(-time.Minute))
+	if err := m.DecodeState(expired, &decoded); err != ErrStateExpired {
+		t.Errorf("expect expired, got %v", err)
+	}
+
+	// 改数据, 改过期时间, 换密钥都要被拒绝
+	parts := strings.Split(state, ".")
+	other, _ := New("", "", WithStateSecret("other")).EncodeState(testState{Build: 42, Target: "ios"}, time.Hour)
+	for _, s := range []string{
+		"",
+		"42_ios",
+		parts[0] + "x." + parts[1] + "." + parts[2],
+		parts[0] + "." + "zzzzzzz" + "." + parts[2],
+		parts[0] + ".." + parts[2],
+		other,
+	} {
+		if err := m.DecodeState(s, &decoded); err != ErrStateInvalid {
+			t.Errorf("%q: expect invalid, got %v", s, err)
+		}
+	}
+
+	if _, err := New("", "").EncodeState(testState{}, 0); err == nil {
+		t.Error("encode without secret should fail")
+	}
+}
+
+func TestContextDecodeState(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	catalogs, _ := ParseCatalogs(testCatalogs)
+	m := New("xoxb-test", "", WithSigningSecret("secret"), WithCatalogs(catalogs), WithLocale("", "en"), WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+
+	var got []string
+	m.RegisterBlockCallback("cancel:{state}", func(ctx context.Context, action *slack.BlockAction, callback slack.InteractionCallback) {
+		var state testState
+		if err := FromContext(ctx).DecodeState(FromContext(ctx).Params["state"], &state); err != nil {
+			got = append(got, "rejected")
+			return
+		}
+		got = append(got, state.Target)
+	})
+
+	state, _ := m.EncodeState(testState{Target: "ios"}, time.Hour)
+
+	for _, id := range []string{state, state + "x"} {
+		var action slack.InteractionCallback
+		json.Unmarshal([]byte(`{"type":"block_actions","response_url":"`+api.URL+`/respond","channel":{"id":"C1"},"user":{"id":"U1"},
+			"actions":[{"action_id":"cancel:`+id+`","block_id":"b"}]}`), &action)
+		m.dispatchInteraction(context.Background(), action)
+	}
+
+	if !reflect.DeepEqual(got, []string{"ios", "rejected"}) {
+		t.Errorf("unexpected results: %q", got)
+	}
+	if calls := api.takeCalls(); !reflect.DeepEqual(calls, []string{"/respond response_type=ephemeral"}) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+}
@@ -0,0 +1,208 @@
+package slackbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v2"
+	"html"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// BlockTemplates 按名字管理block template, 只在加载时解析一次.
+// 所有template在同一个命名空间里, 可以用 {{template "_button" .}} 或者 {{Partial "_button" . | Indent 4}} 引用其它template
+type BlockTemplates struct {
+	lock sync.RWMutex
+
+	root *template.Template
+	yaml map[string]bool
+}
+
+// blockTemplateExts 文件名去掉这些后缀就是template的名字, 比如 build/launcher.json.tmpl 是 build/launcher
+var blockTemplateExts = []struct {
+	ext  string
+	yaml bool
+}{
+	{".json.tmpl", false},
+	{".json", false},
+	{".yaml.tmpl", true},
+	{".yml.tmpl", true},
+	{".yaml", true},
+	{".yml", true},
+}
+
+func NewBlockTemplates() *BlockTemplates {
+	return &BlockTemplates{
+		root: template.New("").Funcs(blockFuncs(untranslated)),
+		yaml: make(map[string]bool),
+	}
+}
+
+// LoadBlockTemplates 加载dir下所有的 *.json.tmpl, *.yaml.tmpl 等template, 包括子目录
+func LoadBlockTemplates(dir string) (*BlockTemplates, error) {
+	return LoadBlockTemplatesFS(os.DirFS(dir))
+}
+
+// LoadBlockTemplatesFS 和LoadBlockTemplates一样. 用embed.FS时, 名字里包含embed的目录, 不需要时先fs.Sub
+func LoadBlockTemplatesFS(fsys fs.FS) (*BlockTemplates, error) {
+	result := NewBlockTemplates()
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		for _, e := range blockTemplateExts {
+			if !strings.HasSuffix(p, e.ext) {
+				continue
+			}
+
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return errors.Wrapf(err, "读取template失败: %s", p)
+			}
+			return result.add(strings.TrimSuffix(p, e.ext), string(data), e.yaml)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Add 添加json的template, 名字重复时覆盖
+func (t *BlockTemplates) Add(name, text string) error {
+	return t.add(name, text, false)
+}
+
+// AddYAML 添加yaml的template, 渲染之后转成json. 比json少写很多引号和括号
+func (t *BlockTemplates) AddYAML(name, text string) error {
+	return t.add(name, text, true)
+}
+
+func (t *BlockTemplates) add(name, text string, isYAML bool) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, err := t.root.New(path.Clean(name)).Parse(text); err != nil {
+		return errors.Wrapf(err, "解析template失败: %s", name)
+	}
+	t.yaml[path.Clean(name)] = isYAML
+	return nil
+}
+
+// Render 渲染成blocks. tr为nil时T不翻译, 在handler里一般传Context.T
+func (t *BlockTemplates) Render(name string, params interface{}, tr Translator) (*slack.Blocks, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	name = path.Clean(name)
+	if t.root.Lookup(name) == nil {
+		return nil, errors.Errorf("没有这个template: %s", name)
+	}
+
+	return executeBlocks(t.root, name, params, tr, t.yaml[name])
+}
+
+// executeBlocks 复制一份再设置T和Partial, 解析好的template可以在多个goroutine里同时使用
+func executeBlocks(root *template.Template, name string, params interface{}, tr Translator, isYAML bool) (*slack.Blocks, error) {
+	if tr == nil {
+		tr = untranslated
+	}
+
+	tplt, err := root.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "复制template失败")
+	}
+
+	tplt.Funcs(template.FuncMap{
+		"T": tr,
+		"Partial": func(name string, data interface{}) (string, error) {
+			buf := &bytes.Buffer{}
+			err := tplt.ExecuteTemplate(buf, name, data)
+			return buf.String(), err
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := tplt.ExecuteTemplate(buf, name, params); err != nil {
+		return nil, errors.Wrap(err, "template执行失败")
+	}
+
+	data := buf.Bytes()
+	if isYAML {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &slack.Blocks{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, errors.Wrap(err, "json解析为blocks出错")
+	}
+
+	return result, nil
+}
+
+// blockFuncs template里可以用的函数. Partial只在执行时才能用
+func blockFuncs(tr Translator) template.FuncMap {
+	return template.FuncMap{
+		"EscapeString": html.EscapeString,
+		"EscapeJSON":   escapeJSON,
+		"EscapeMrkdwn": escapeMrkdwn,
+		"Indent":       indent,
+		"T":            tr,
+		"Partial": func(name string, data interface{}) (string, error) {
+			return "", errors.New("Partial只能在BlockTemplates里使用")
+		},
+	}
+}
+
+// escapeJSON 转义成json字符串的内容, 不带两边的引号. 用在 "text": "{{EscapeJSON .Text}}"
+func escapeJSON(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+// indent 除了第一行, 每一行前面加n个空格. yaml里引用partial时对齐缩进
+func indent(n int, s string) string {
+	return strings.Replace(s, "\n", "\n"+strings.Repeat(" ", n), -1)
+}
+
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, errors.Wrap(err, "yaml解析失败")
+	}
+
+	result, err := json.Marshal(jsonValue(value))
+	return result, errors.Wrap(err, "yaml转json失败")
+}
+
+// jsonValue yaml.v2的map是map[interface{}]interface{}, json不支持
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
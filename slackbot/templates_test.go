@@ -0,0 +1,124 @@
+package slackbot
+
+import (
+	"github.com/slack-go/slack"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func sectionText(t *testing.T, blocks *slack.Blocks, i int) string {
+	section, ok := blocks.BlockSet[i].(*slack.SectionBlock)
+	if !ok {
+		t.Fatalf("block %d is not a section: %+v", i, blocks.BlockSet[i])
+	}
+	return section.Text.Text
+}
+
+func TestEscapeJSON(t *testing.T) {
+	block := `[{"type": "section", "text": {"type": "mrkdwn", "text": "{{EscapeJSON .Text}} {{EscapeMrkdwn .Link | EscapeJSON}}"}}]`
+
+	text := "say \"hi\"\\\nnext line"
+	blocks, err := NewBlockMessage(block, map[string]string{"Text": text, "Link": "<@U1>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sectionText(t, blocks, 0); got != text+" &lt;@U1&gt;" {
+		t.Errorf("unexpected text: %q", got)
+	}
+}
+
+func TestLoadBlockTemplatesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_button.json.tmpl": {Data: []byte(`{"type": "button", "action_id": "{{.ID}}", "text": {"type": "plain_text", "text": "{{T .Text | EscapeJSON}}"}}`)},
+		"build/launcher.json.tmpl": {Data: []byte(`[
+			{"type": "section", "text": {"type": "plain_text", "text": "{{T "构建目标"}}: {{EscapeJSON .Tag}}"}},
+			{"type": "actions", "elements": [{{template "_button" .Button}}]}
+		]`)},
+		"build/result.yaml.tmpl": {Data: []byte(`
+- type: section
+  text:
+    type: mrkdwn
+    text: "{{EscapeJSON .Text}}"
+- type: actions
+  elements:
+    - {{Partial "_button" .Button | Indent 6}}
+`)},
+		"README.md": {Data: []byte("不是template")},
+	}
+
+	templates, err := LoadBlockTemplatesFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalogs, _ := ParseCatalogs(testCatalogs)
+	m := New("", "", WithCatalogs(catalogs))
+
+	params := map[string]interface{}{
+		"Tag":    `ios "beta"`,
+		"Text":   "第一行\n第二行: *done*",
+		"Button": map[string]string{"ID": "cancel", "Text": "新建构建"},
+	}
+
+	blocks, err := templates.Render("build/launcher", params, m.Translator("en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sectionText(t, blocks, 0); got != `Build target: ios "beta"` {
+		t.Errorf("unexpected text: %q", got)
+	}
+	button := blocks.BlockSet[1].(*slack.ActionBlock).Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	if button.ActionID != "cancel" || button.Text.Text != "New build" {
+		t.Errorf("unexpected button: %+v", button)
+	}
+
+	blocks, err = templates.Render("build/result", params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sectionText(t, blocks, 0); got != "第一行\n第二行: *done*" {
+		t.Errorf("unexpected text: %q", got)
+	}
+	button = blocks.BlockSet[1].(*slack.ActionBlock).Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	if button.ActionID != "cancel" || button.Text.Text != "新建构建" {
+		t.Errorf("unexpected button: %+v", button)
+	}
+
+	if _, err := templates.Render("README", nil, nil); err == nil {
+		t.Error("README.md should not be loaded")
+	}
+}
+
+func TestBlockTemplatesConcurrentLocales(t *testing.T) {
+	catalogs, _ := ParseCatalogs(testCatalogs)
+	m := New("", "", WithCatalogs(catalogs))
+
+	templates := NewBlockTemplates()
+	if err := templates.Add("target", `[{"type": "section", "text": {"type": "plain_text", "text": "{{T "构建目标"}}"}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		locale, expect := "en", "Build target"
+		if i%2 == 0 {
+			locale, expect = "zh", "构建目标"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocks, err := templates.Render("target", nil, m.Translator(locale))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got := blocks.BlockSet[0].(*slack.SectionBlock).Text.Text; got != expect {
+				t.Errorf("%s: expect %s, got %s", locale, expect, got)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,370 @@
+package slackbot
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+	"unicode/utf8"
+)
+
+// slack的限制, 见 https://api.slack.com/reference/block-kit
+const (
+	MaxMessageBlocks = 50
+	MaxViewBlocks    = 100
+
+	maxSectionText  = 3000
+	maxSectionField = 2000
+	maxHeaderText   = 150
+	maxViewTitle    = 24
+)
+
+// BlockError Path形如 blocks[3].elements[1].action_id
+type BlockError struct {
+	Path   string
+	Reason string
+}
+
+func (e *BlockError) Error() string {
+	return e.Path + ": " + e.Reason
+}
+
+// BlockErrors ValidateBlocks发现的所有问题
+type BlockErrors []*BlockError
+
+func (e BlockErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateBlocks 按消息的限制检查blocks, 有问题时返回BlockErrors
+func ValidateBlocks(blocks []slack.Block) error {
+	return validateBlocks(blocks, MaxMessageBlocks)
+}
+
+// ValidateView 按modal的限制检查title, submit, close和blocks
+func ValidateView(view *slack.ModalViewRequest) error {
+	v := newBlockValidator()
+	v.text("title", view.Title, maxViewTitle, true)
+	v.text("submit", view.Submit, maxViewTitle, false)
+	v.text("close", view.Close, maxViewTitle, false)
+	v.length("callback_id", view.CallbackID, 255)
+	v.length("private_metadata", view.PrivateMetadata, 3000)
+	v.blocks(view.Blocks.BlockSet, MaxViewBlocks)
+	return v.result()
+}
+
+func validateBlocks(blocks []slack.Block, max int) error {
+	v := newBlockValidator()
+	v.blocks(blocks, max)
+	return v.result()
+}
+
+type blockValidator struct {
+	errs     BlockErrors
+	blockIDs map[string]string
+}
+
+func newBlockValidator() *blockValidator {
+	return &blockValidator{blockIDs: make(map[string]string)}
+}
+
+func (v *blockValidator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (v *blockValidator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &BlockError{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (v *blockValidator) length(path, s string, max int) {
+	if n := utf8.RuneCountInString(s); n > max {
+		v.fail(path, "超过%d个字符(%d)", max, n)
+	}
+}
+
+func (v *blockValidator) text(path string, text *slack.TextBlockObject, max int, required bool) {
+	if text == nil || text.Text == "" {
+		if required {
+			v.fail(path, "不能为空")
+		}
+		return
+	}
+	v.length(path+".text", text.Text, max)
+}
+
+func (v *blockValidator) count(path string, n, max int) {
+	if n > max {
+		v.fail(path, "最多%d个, 实际%d个", max, n)
+	}
+}
+
+func (v *blockValidator) blocks(blocks []slack.Block, max int) {
+	v.count("blocks", len(blocks), max)
+
+	for i, block := range blocks {
+		v.block(fmt.Sprintf("blocks[%d]", i), block)
+	}
+}
+
+func (v *blockValidator) blockID(path, id string) {
+	if id == "" {
+		return
+	}
+	v.length(path+".block_id", id, 255)
+	if other, has := v.blockIDs[id]; has {
+		v.fail(path+".block_id", "和%s重复: %s", other, id)
+		return
+	}
+	v.blockIDs[id] = path
+}
+
+func (v *blockValidator) block(path string, block slack.Block) {
+	// action_id只需要在同一个block里唯一
+	actionIDs := make(map[string]string)
+
+	switch b := block.(type) {
+	case *slack.SectionBlock:
+		v.blockID(path, b.BlockID)
+		if (b.Text == nil || b.Text.Text == "") && len(b.Fields) == 0 {
+			v.fail(path, "section需要text或者fields")
+		}
+		v.text(path+".text", b.Text, maxSectionText, false)
+		v.count(path+".fields", len(b.Fields), 10)
+		for i, field := range b.Fields {
+			v.text(fmt.Sprintf("%s.fields[%d]", path, i), field, maxSectionField, true)
+		}
+		if element := accessoryElement(b.Accessory); element != nil {
+			v.element(path+".accessory", element, actionIDs)
+		}
+
+	case *slack.HeaderBlock:
+		v.blockID(path, b.BlockID)
+		v.text(path+".text", b.Text, maxHeaderText, true)
+
+	case *slack.ActionBlock:
+		v.blockID(path, b.BlockID)
+		if b.Elements == nil || len(b.Elements.ElementSet) == 0 {
+			v.fail(path+".elements", "不能为空")
+			return
+		}
+		v.count(path+".elements", len(b.Elements.ElementSet), 25)
+		for i, element := range b.Elements.ElementSet {
+			v.element(fmt.Sprintf("%s.elements[%d]", path, i), element, actionIDs)
+		}
+
+	case *slack.ContextBlock:
+		v.blockID(path, b.BlockID)
+		v.count(path+".elements", len(b.ContextElements.Elements), 10)
+		for i, element := range b.ContextElements.Elements {
+			if text, ok := element.(*slack.TextBlockObject); ok {
+				v.text(fmt.Sprintf("%s.elements[%d]", path, i), text, maxSectionText, true)
+			}
+		}
+
+	case *slack.ImageBlock:
+		v.blockID(path, b.BlockID)
+		v.length(path+".image_url", b.ImageURL, 3000)
+		v.length(path+".alt_text", b.AltText, 2000)
+		v.text(path+".title", b.Title, 2000, false)
+
+	case *slack.InputBlock:
+		v.blockID(path, b.BlockID)
+		v.text(path+".label", b.Label, 2000, true)
+		v.text(path+".hint", b.Hint, 2000, false)
+		if b.Element == nil {
+			v.fail(path+".element", "不能为空")
+		} else {
+			v.element(path+".element", b.Element, actionIDs)
+		}
+
+	case *slack.DividerBlock:
+		v.blockID(path, b.BlockID)
+
+	case *slack.FileBlock:
+		v.blockID(path, b.BlockID)
+	}
+}
+
+func accessoryElement(a *slack.Accessory) slack.BlockElement {
+	switch {
+	case a == nil:
+		return nil
+	case a.ImageElement != nil:
+		return a.ImageElement
+	case a.ButtonElement != nil:
+		return a.ButtonElement
+	case a.OverflowElement != nil:
+		return a.OverflowElement
+	case a.DatePickerElement != nil:
+		return a.DatePickerElement
+	case a.TimePickerElement != nil:
+		return a.TimePickerElement
+	case a.PlainTextInputElement != nil:
+		return a.PlainTextInputElement
+	case a.RadioButtonsElement != nil:
+		return a.RadioButtonsElement
+	case a.SelectElement != nil:
+		return a.SelectElement
+	case a.MultiSelectElement != nil:
+		return a.MultiSelectElement
+	case a.CheckboxGroupsBlockElement != nil:
+		return a.CheckboxGroupsBlockElement
+	}
+	return nil
+}
+
+func (v *blockValidator) actionID(path, id string, actionIDs map[string]string) {
+	if id == "" {
+		return
+	}
+	v.length(path+".action_id", id, 255)
+	if other, has := actionIDs[id]; has {
+		v.fail(path+".action_id", "和%s重复: %s", other, id)
+		return
+	}
+	actionIDs[id] = path
+}
+
+func (v *blockValidator) element(path string, element slack.BlockElement, actionIDs map[string]string) {
+	switch e := element.(type) {
+	case *slack.ButtonBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".text", e.Text, 75, true)
+		v.length(path+".value", e.Value, 2000)
+		v.length(path+".url", e.URL, 3000)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.SelectBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".placeholder", e.Placeholder, 150, false)
+		v.options(path+".options", e.Options, 100)
+		v.optionGroups(path+".option_groups", e.OptionGroups)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.MultiSelectBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".placeholder", e.Placeholder, 150, false)
+		v.options(path+".options", e.Options, 100)
+		v.optionGroups(path+".option_groups", e.OptionGroups)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.OverflowBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		if len(e.Options) < 2 {
+			v.fail(path+".options", "至少2个, 实际%d个", len(e.Options))
+		}
+		v.options(path+".options", e.Options, 5)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.CheckboxGroupsBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.options(path+".options", e.Options, 10)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.RadioButtonsBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.options(path+".options", e.Options, 10)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.PlainTextInputBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".placeholder", e.Placeholder, 150, false)
+		v.length(path+".initial_value", e.InitialValue, 3000)
+
+	case *slack.DatePickerBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".placeholder", e.Placeholder, 150, false)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.TimePickerBlockElement:
+		v.actionID(path, e.ActionID, actionIDs)
+		v.text(path+".placeholder", e.Placeholder, 150, false)
+		v.confirm(path+".confirm", e.Confirm)
+
+	case *slack.ImageBlockElement:
+		v.length(path+".image_url", e.ImageURL, 3000)
+		v.length(path+".alt_text", e.AltText, 2000)
+	}
+}
+
+func (v *blockValidator) options(path string, options []*slack.OptionBlockObject, max int) {
+	v.count(path, len(options), max)
+	for i, option := range options {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		v.text(p+".text", option.Text, 75, true)
+		v.length(p+".value", option.Value, 150)
+		v.text(p+".description", option.Description, 75, false)
+		v.length(p+".url", option.URL, 3000)
+	}
+}
+
+func (v *blockValidator) optionGroups(path string, groups []*slack.OptionGroupBlockObject) {
+	v.count(path, len(groups), 100)
+	for i, group := range groups {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		v.text(p+".label", group.Label, 75, true)
+		v.options(p+".options", group.Options, 100)
+	}
+}
+
+func (v *blockValidator) confirm(path string, c *slack.ConfirmationBlockObject) {
+	if c == nil {
+		return
+	}
+	v.text(path+".title", c.Title, 100, true)
+	v.text(path+".text", c.Text, 300, true)
+	v.text(path+".confirm", c.Confirm, 30, true)
+	v.text(path+".deny", c.Deny, 30, true)
+}
+
+// TruncateBlocks 把section, header和context里超长的文字截断, 结尾加上…. 直接修改blocks
+func TruncateBlocks(blocks []slack.Block) []slack.Block {
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *slack.SectionBlock:
+			truncateText(b.Text, maxSectionText)
+			for _, field := range b.Fields {
+				truncateText(field, maxSectionField)
+			}
+		case *slack.HeaderBlock:
+			truncateText(b.Text, maxHeaderText)
+		case *slack.ContextBlock:
+			for _, element := range b.ContextElements.Elements {
+				if text, ok := element.(*slack.TextBlockObject); ok {
+					truncateText(text, maxSectionText)
+				}
+			}
+		}
+	}
+	return blocks
+}
+
+func truncateText(text *slack.TextBlockObject, max int) {
+	if text == nil || utf8.RuneCountInString(text.Text) <= max {
+		return
+	}
+	text.Text = string([]rune(text.Text)[:max-1]) + "…"
+}
+
+// SplitBlocks 按max分成多条消息, 一般是MaxMessageBlocks. max必须大于0
+func SplitBlocks(blocks []slack.Block, max int) [][]slack.Block {
+	if max <= 0 {
+		panic(fmt.Sprintf("SplitBlocks的max必须大于0: %d", max))
+	}
+
+	var result [][]slack.Block
+	for len(blocks) > max {
+		result = append(result, blocks[:max])
+		blocks = blocks[max:]
+	}
+	if len(blocks) > 0 {
+		result = append(result, blocks)
+	}
+	return result
+}
@@ -0,0 +1,109 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateBlocks(t *testing.T) {
+	long := strings.Repeat("长", 3001)
+	button := func(id string) slack.BlockElement {
+		return slack.NewButtonBlockElement(id, "v", slack.NewTextBlockObject(slack.PlainTextType, "ok", false, false))
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, long, false, false), nil, nil, slack.SectionBlockOptionBlockID("a")),
+		slack.NewActionBlock("a", button("cancel"), button("cancel")),
+		slack.NewActionBlock("b", button("cancel")),
+		slack.NewDividerBlock(),
+	}
+
+	err := ValidateBlocks(blocks)
+	errs, ok := err.(BlockErrors)
+	if !ok {
+		t.Fatalf("expect BlockErrors, got %v", err)
+	}
+
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	expect := []string{"blocks[0].text.text", "blocks[1].block_id", "blocks[1].elements[1].action_id"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("unexpected errors: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "超过3000个字符(3001)") {
+		t.Errorf("unexpected reason: %s", err)
+	}
+
+	// 不同block里的action_id可以相同
+	if err := ValidateBlocks(blocks[2:]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateBlocksCount(t *testing.T) {
+	var blocks []slack.Block
+	for i := 0; i < MaxMessageBlocks+1; i++ {
+		blocks = append(blocks, slack.NewDividerBlock())
+	}
+
+	if err := ValidateBlocks(blocks); err == nil || err.(BlockErrors)[0].Path != "blocks" {
+		t.Errorf("expect too many blocks, got %v", err)
+	}
+
+	view := NewModalViewWithBlocks("launcher", strings.Repeat("长", maxViewTitle+1), "", &slack.Blocks{BlockSet: blocks})
+	err := ValidateView(view)
+	if err == nil || len(err.(BlockErrors)) != 1 || err.(BlockErrors)[0].Path != "title.text" {
+		t.Errorf("modal allows 100 blocks but title is too long, got %v", err)
+	}
+
+	if chunks := SplitBlocks(blocks, MaxMessageBlocks); len(chunks) != 2 || len(chunks[0]) != MaxMessageBlocks || len(chunks[1]) != 1 {
+		t.Errorf("unexpected chunks: %d", len(chunks))
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("max 0 should panic instead of looping forever")
+			}
+		}()
+		SplitBlocks(blocks, 0)
+	}()
+}
+
+func TestReplyBlocks(t *testing.T) {
+	api := newFakeSlackAPI()
+	defer api.Close()
+
+	m := New("xoxb-test", "", WithSlackOptions(slack.OptionAPIURL(api.URL+"/")))
+	c := m.newContext(context.Background(), &Request{Channel: "C1", User: "U1"})
+
+	var blocks []slack.Block
+	for i := 0; i < 60; i++ {
+		blocks = append(blocks, markdownSection(strings.Repeat("x", 3100)))
+	}
+
+	if err := c.ReplyBlocks("build log", blocks); err != nil {
+		t.Fatal(err)
+	}
+	if text := blocks[0].(*slack.SectionBlock).Text.Text; len([]rune(text)) != maxSectionText || !strings.HasSuffix(text, "…") {
+		t.Errorf("text should be truncated: %d", len([]rune(text)))
+	}
+	if calls := api.takeCalls(); len(calls) != 2 {
+		t.Errorf("expect 2 messages, got %q", calls)
+	}
+
+	// 不满足限制时一条都不发
+	bad := []slack.Block{slack.NewActionBlock("", slack.NewOverflowBlockElement("more"))}
+	if err := c.ReplyBlocks("", bad); err == nil {
+		t.Error("overflow needs at least 2 options")
+	}
+	if calls := api.takeCalls(); len(calls) != 0 {
+		t.Errorf("should not send: %q", calls)
+	}
+}
@@ -0,0 +1,53 @@
+package slackbot
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"net/http"
+)
+
+// WithSigningSecret 使用X-Slack-Signature校验所有请求, 取代已经废弃的verification token.
+// 请求时间戳与当前时间相差超过5分钟的会被拒绝, 以防重放
+func WithSigningSecret(secret string) option {
+	return func(manager *Manager) {
+		manager.signingSecret = secret
+	}
+}
+
+// verifyRequest 读出body并校验签名. 读出的body会放回request里, 之后还可以再解析form
+func (m *Manager) verifyRequest(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取body失败")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if m.signingSecret == "" {
+		return body, nil
+	}
+
+	sv, err := slack.NewSecretsVerifier(r.Header, m.signingSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "签名header校验失败")
+	}
+
+	if _, err := sv.Write(body); err != nil {
+		return nil, errors.Wrap(err, "计算签名失败")
+	}
+
+	if err := sv.Ensure(); err != nil {
+		return nil, errors.Wrap(err, "签名不匹配")
+	}
+
+	return body, nil
+}
+
+// verifyToken 没有设置signing secret时, 退回到比较verification token
+func (m *Manager) verifyToken(token string) bool {
+	if m.signingSecret != "" {
+		return true
+	}
+	return token == m.slackVerificationToken
+}
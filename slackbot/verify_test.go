@@ -0,0 +1,90 @@
+package slackbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signRequest(req *http.Request, secret, body string, ts time.Time) {
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "v0:%s:%s", stamp, body)
+
+	req.Header.Set("X-Slack-Request-Timestamp", stamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestSigningSecret(t *testing.T) {
+	m := New("", "", WithSigningSecret("secret"))
+
+	called := 0
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		called++
+	})
+
+	r := m.Handler()
+
+	body := url.Values{"command": {"/ucb"}, "text": {"build ios"}}.Encode()
+
+	cases := []struct {
+		name   string
+		secret string
+		ts     time.Time
+		sign   bool
+		code   int
+	}{
+		{"valid", "secret", time.Now(), true, http.StatusOK},
+		{"wrong secret", "other", time.Now(), true, http.StatusUnauthorized},
+		{"replayed", "secret", time.Now().Add(-10 * time.Minute), true, http.StatusUnauthorized},
+		{"unsigned", "", time.Now(), false, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.sign {
+			signRequest(req, c.secret, body, c.ts)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.code {
+			t.Errorf("%s: expect %d, got %d", c.name, c.code, w.Code)
+		}
+	}
+
+	if called != 1 {
+		t.Errorf("handler called %d times", called)
+	}
+}
+
+func TestSigningSecretEvent(t *testing.T) {
+	m := New("", "", WithSigningSecret("secret"))
+
+	r := m.Handler()
+
+	body := `{"type":"url_verification","challenge":"abc"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/message", strings.NewReader(body))
+	signRequest(req, "secret", body, time.Now())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "abc" {
+		t.Errorf("status: %d body: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,99 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// ViewSubmission 返回nil表示直接关闭modal. 需要提示输入错误时返回slack.NewErrorsViewSubmissionResponse
+type ViewSubmission func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback) *slack.ViewSubmissionResponse
+
+type ViewClosed func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback)
+
+func (m *Manager) RegisterViewSubmission(callbackID string, callback ViewSubmission, options ...registerOption) {
+	if _, has := m.viewSubmissionMap[callbackID]; has {
+		panic("重复注册了view submission: " + callbackID)
+	}
+	m.viewSubmissionMap[callbackID] = callback
+	m.addCallbackRegistration(KindViewSubmission, callbackID, options)
+}
+
+// RegisterViewClosed 只有modal设置了notify_on_close才会收到view_closed
+func (m *Manager) RegisterViewClosed(callbackID string, callback ViewClosed, options ...registerOption) {
+	if _, has := m.viewClosedMap[callbackID]; has {
+		panic("重复注册了view closed: " + callbackID)
+	}
+	m.viewClosedMap[callbackID] = callback
+	m.addCallbackRegistration(KindViewClosed, callbackID, options)
+}
+
+// viewRequest 设置了MetadataChannel时, channel从private_metadata里取
+func viewRequest(kind, id string, params map[string]string, action *slack.InteractionCallback, reg *registration) *Request {
+	req := interactionRequest(kind, id, params, action)
+	if req.Channel == "" && reg != nil && reg.metadataChannel {
+		req.Channel = action.View.PrivateMetadata
+	}
+	return req
+}
+
+// deniedViewResponse 没有权限时把modal换成原因, 直接关掉的话用户不知道发生了什么
+func (m *Manager) deniedViewResponse(ctx context.Context, req *Request, view *slack.View, err error) *slack.ViewSubmissionResponse {
+	locale := m.Locale(ctx, req.TeamID, req.User)
+
+	title := view.Title
+	if title == nil {
+		title = PlainText(m.T(locale, "没有权限"))
+	}
+
+	return slack.NewUpdateViewSubmissionResponse(&slack.ModalViewRequest{
+		Type:   slack.VTModal,
+		Title:  title,
+		Close:  PlainText(m.T(locale, "关闭")),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{markdownSection(escapeMrkdwn(m.ErrorText(locale, err)))}},
+	})
+}
+
+// NewModalView 用NewBlockMessage的template生成modal. submit为空时不显示提交按钮
+func NewModalView(callbackID, title, submit, block string, params interface{}) (*slack.ModalViewRequest, error) {
+	return newModalView(callbackID, title, submit, block, params, untranslated)
+}
+
+func newModalView(callbackID, title, submit, block string, params interface{}, t Translator) (*slack.ModalViewRequest, error) {
+	blocks, err := newBlockMessage(block, params, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewModalViewWithBlocks(callbackID, t(title), t(submit), blocks), nil
+}
+
+// NewModalViewWithBlocks blocks已经渲染好, 比如来自BlockTemplates. submit为空时不显示提交按钮
+func NewModalViewWithBlocks(callbackID, title, submit string, blocks *slack.Blocks) *slack.ModalViewRequest {
+	result := &slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: callbackID,
+		Title:      slack.NewTextBlockObject(slack.PlainTextType, title, false, false),
+		Blocks:     *blocks,
+	}
+
+	if submit != "" {
+		result.Submit = slack.NewTextBlockObject(slack.PlainTextType, submit, false, false)
+	}
+
+	return result
+}
+
+// OpenModal 用交互回调或者slash command里的trigger id打开modal. trigger id只有3秒有效期.
+// 先用ValidateView检查, 不满足slack的限制时不调用api
+func (m *Manager) OpenModal(ctx context.Context, triggerID string, view *slack.ModalViewRequest) (*slack.ViewResponse, error) {
+	if err := ValidateView(view); err != nil {
+		return nil, errors.Wrap(err, "modal不满足slack的限制")
+	}
+
+	resp, err := m.slackApi.OpenViewContext(ctx, triggerID, *view)
+	if err != nil {
+		return nil, errors.Wrap(err, "打开modal失败")
+	}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const launcherTemplate = `[
+	{
+		"type": "input",
+		"block_id": "tag",
+		"label": {"type": "plain_text", "text": "Target"},
+		"element": {"type": "plain_text_input", "action_id": "value", "initial_value": "{{.Tag}}"}
+	}
+]`
+
+func postInteraction(m *Manager, payload string) *httptest.ResponseRecorder {
+	r := m.Handler()
+
+	body := url.Values{"payload": {payload}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/interact", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestViewSubmissionErrors(t *testing.T) {
+	m := New("", "verify")
+
+	m.RegisterViewSubmission("launcher", func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback) *slack.ViewSubmissionResponse {
+		if view.State.Values["tag"]["value"].Value == "" {
+			return slack.NewErrorsViewSubmissionResponse(map[string]string{"tag": "required"})
+		}
+		return nil
+	})
+
+	w := postInteraction(m, `{"type":"view_submission","token":"verify","trigger_id":"t1","user":{"id":"U1"},
+		"view":{"callback_id":"launcher","state":{"values":{"tag":{"value":{"type":"plain_text_input","value":""}}}}}}`)
+
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %s", err, w.Body.String())
+	}
+
+	if resp.ResponseAction != slack.RAErrors || resp.Errors["tag"] != "required" {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+
+	w = postInteraction(m, `{"type":"view_submission","token":"verify","trigger_id":"t2","user":{"id":"U1"},
+		"view":{"callback_id":"launcher","state":{"values":{"tag":{"value":{"type":"plain_text_input","value":"ios"}}}}}}`)
+
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("status: %d body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestViewClosed(t *testing.T) {
+	m := New("", "verify")
+
+	closed := false
+	m.RegisterViewClosed("launcher", func(ctx context.Context, view *slack.View, fullCallback slack.InteractionCallback) {
+		closed = true
+	})
+
+	postInteraction(m, `{"type":"view_closed","token":"verify","user":{"id":"U1"},"view":{"callback_id":"launcher"}}`)
+
+	if !closed {
+		t.Error("view closed not called")
+	}
+}
+
+func TestOpenModal(t *testing.T) {
+	var got url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		got = url.Values{"path": {r.URL.Path}, "trigger_id": {req["trigger_id"].(string)}}
+		w.Write([]byte(`{"ok":true,"view":{"id":"V1"}}`))
+	}))
+	defer server.Close()
+
+	m := New("xoxb", "", WithSlackOptions(slack.OptionAPIURL(server.URL+"/")))
+
+	view, err := NewModalView("launcher", "Build", "Start", launcherTemplate, map[string]string{"Tag": "ios"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if view.Submit == nil || len(view.Blocks.BlockSet) != 1 {
+		t.Errorf("unexpected view: %+v", view)
+	}
+
+	resp, err := m.OpenModal(context.Background(), "t1", view)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.ID != "V1" || got.Get("path") != "/views.open" || got.Get("trigger_id") != "t1" {
+		t.Errorf("unexpected request: %v, resp: %+v", got, resp)
+	}
+}
@@ -0,0 +1,193 @@
+package slackbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrBusy 排队的handler超过WithQueueLimit时, 新的请求不执行, 把这个错误交给中间件
+var ErrBusy = NewLocalizedError("bot正忙, 请稍后再试")
+
+// workerPool 限制同时执行的handler数量. 排队的handler也算在pending里
+type workerPool struct {
+	slots   chan struct{}
+	timeout time.Duration
+	pending sync.WaitGroup
+
+	lock sync.Mutex
+	// queued 在等slot的handler数量
+	queued int
+}
+
+// WithWorkers 收到事件后立即回复slack, handler在后台执行, 同时最多执行size个.
+// timeout是每个handler的默认超时, 可以用Timeout单独设置. handler的回复要通过response_url或者Web API发送
+// 在lambda里要等handler执行完才能返回, 做不到立即回复, 见apigateway.Handler
+// 默认只限制并发, 排队的数量不限, 用WithQueueLimit限制
+func WithWorkers(size int, timeout time.Duration) option {
+	if size <= 0 {
+		panic("WithWorkers的size必须大于0")
+	}
+	if timeout <= 0 {
+		panic("WithWorkers的timeout必须大于0")
+	}
+
+	return func(manager *Manager) {
+		manager.workers = &workerPool{
+			slots:   make(chan struct{}, size),
+			timeout: timeout,
+		}
+	}
+}
+
+// WithQueueLimit 最多limit个handler等待执行, 再多时直接拒绝, 用ErrBusy报告给中间件. 只在设置了WithWorkers时有效
+func WithQueueLimit(limit int) option {
+	return func(manager *Manager) {
+		manager.queueLimit = limit
+	}
+}
+
+// Timeout handler的超时, 覆盖WithWorkers的默认值. 只在后台执行时有效
+func Timeout(timeout time.Duration) registerOption {
+	return func(r *registration) {
+		r.timeout = timeout
+	}
+}
+
+// schedule 没有设置WithWorkers时直接执行, 否则放到后台执行.
+// 后台执行时http请求已经结束, 不能再用请求的ctx
+func (m *Manager) schedule(ctx context.Context, req *Request, reg *registration, process func(ctx context.Context)) {
+	if m.workers == nil {
+		m.execute(ctx, req, reg, process)
+		return
+	}
+
+	timeout := m.workers.timeout
+	if reg != nil && reg.timeout > 0 {
+		timeout = reg.timeout
+	}
+
+	ok := m.spawn(timeout, req.logFields(nil), func(ctx context.Context) {
+		m.execute(ctx, req, reg, process)
+	})
+	if !ok {
+		m.logger.Warn("排队的handler太多, 拒绝执行", req.logFields(Fields{"limit": m.queueLimit}))
+		m.execute(ctx, req, reg, func(ctx context.Context) {
+			ReportError(ctx, ErrBusy)
+		})
+	}
+}
+
+// spawn 在worker里执行, 排队已满时返回false. 后台执行时http请求已经结束, 用新的ctx
+func (m *Manager) spawn(timeout time.Duration, fields Fields, process func(ctx context.Context)) bool {
+	if !m.workers.enqueue(m.queueLimit) {
+		return false
+	}
+
+	m.workers.pending.Add(1)
+	go func() {
+		defer m.workers.pending.Done()
+
+		m.workers.slots <- struct{}{}
+		m.workers.dequeue()
+		defer func() { <-m.workers.slots }()
+
+		// 后台的panic没有http server的recover兜底
+		defer m.recoverTask(fields)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		process(ctx)
+	}()
+	return true
+}
+
+func (m *Manager) recoverTask(fields Fields) {
+	if r := recover(); r != nil {
+		result := Fields{"panic": fmt.Sprint(r), "stack": string(debug.Stack())}
+		for k, v := range fields {
+			result[k] = v
+		}
+		m.logger.Error("handler panic", result)
+	}
+}
+
+// Go 执行bot自己的后台任务, 比如构建状态变了之后刷新Home tab. 不属于哪个用户的请求, 不经过中间件和权限检查,
+// Drain会等它执行完. 排队已满时不执行, 返回ErrBusy. 没有设置WithWorkers时直接执行
+func (m *Manager) Go(ctx context.Context, name string, process func(ctx context.Context)) error {
+	fields := Fields{"task": name}
+
+	if m.workers == nil {
+		defer m.recoverTask(fields)
+		process(ctx)
+		return nil
+	}
+
+	if !m.spawn(m.workers.timeout, fields, process) {
+		m.logger.Warn("排队的任务太多, 拒绝执行", Fields{"task": name, "limit": m.queueLimit})
+		return ErrBusy
+	}
+	return nil
+}
+
+// enqueue limit<=0时不限制排队数量
+func (p *workerPool) enqueue(limit int) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if limit > 0 && p.queued >= limit {
+		return false
+	}
+	p.queued++
+	return true
+}
+
+func (p *workerPool) dequeue() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.queued--
+}
+
+// Background 把handler里慢的部分放到后台执行, 比如view submission要在3秒内回复, 先校验表单关掉modal.
+// 和注册的handler一样经过中间件, ReportError报告的错误交给中间件. 没有设置WithWorkers, 或者不是在handler里调用时直接执行
+func Background(ctx context.Context, process func(ctx context.Context)) {
+	c, r := FromContext(ctx), RequestFromContext(ctx)
+	if c == nil || r == nil {
+		process(ctx)
+		return
+	}
+
+	req := *r
+	req.err = nil
+	c.manager.schedule(ctx, &req, req.reg, process)
+}
+
+// Drain 等待后台的handler执行完, 直到ctx结束. lambda在返回之前调用, 否则进程被冻结后handler就不会执行了
+func (m *Manager) Drain(ctx context.Context) error {
+	if m.workers == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Respond 通过slash command和交互回调里的response_url回复, 在后台执行时也能用
+func (m *Manager) Respond(ctx context.Context, responseURL string, msg *slack.WebhookMessage) error {
+	return slack.PostWebhookContext(ctx, responseURL, msg)
+}
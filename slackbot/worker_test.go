@@ -0,0 +1,219 @@
+package slackbot
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkersAckImmediately(t *testing.T) {
+	m := New("", "verification", WithWorkers(2, time.Second))
+
+	release := make(chan struct{})
+	var lock sync.Mutex
+	running, maxRunning, finished := 0, 0, 0
+
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		<-release
+
+		lock.Lock()
+		running--
+		finished++
+		lock.Unlock()
+	})
+
+	for i := 0; i < 5; i++ {
+		w := postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/ucb"}})
+		if w.Code != 200 {
+			t.Fatalf("status: %d", w.Code)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if err := m.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("handlers are still blocked, drain should time out: %v", err)
+	}
+	cancel()
+
+	close(release)
+
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if finished != 5 || maxRunning != 2 {
+		t.Errorf("finished %d, max running %d", finished, maxRunning)
+	}
+}
+
+func TestWorkersTimeout(t *testing.T) {
+	m := New("", "verification", WithWorkers(1, time.Second))
+
+	var err error
+	m.RegisterSlashCommand("/slow", func(ctx context.Context, cmd *slack.SlashCommand) {
+		<-ctx.Done()
+		err = ctx.Err()
+	}, Timeout(10*time.Millisecond))
+
+	m.RegisterSlashCommand("/panic", func(ctx context.Context, cmd *slack.SlashCommand) {
+		panic("boom")
+	})
+
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/panic"}})
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/slow"}})
+
+	if drainErr := m.Drain(context.Background()); drainErr != nil {
+		t.Fatal(drainErr)
+	}
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("handler should time out: %v", err)
+	}
+}
+
+func TestBackground(t *testing.T) {
+	m := New("", "verification", WithWorkers(1, time.Second))
+
+	var reported []error
+	m.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			err := next(ctx, req)
+			reported = append(reported, err)
+			return err
+		}
+	})
+
+	release := make(chan struct{})
+	var user string
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		Background(ctx, func(ctx context.Context) {
+			<-release
+			user = FromContext(ctx).User
+			ReportError(ctx, errors.New("build failed"))
+		})
+	})
+
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/ucb"}, "user_id": {"U1"}})
+
+	close(release)
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != "U1" || len(reported) != 2 || reported[0] != nil || reported[1] == nil {
+		t.Errorf("user %q, reported %v", user, reported)
+	}
+}
+
+func TestWorkersQueueLimit(t *testing.T) {
+	m := New("", "verification", WithWorkers(1, time.Second), WithQueueLimit(1))
+
+	var lock sync.Mutex
+	var reported []error
+	m.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			err := next(ctx, req)
+			lock.Lock()
+			reported = append(reported, err)
+			lock.Unlock()
+			return err
+		}
+	})
+
+	started, release := make(chan struct{}, 3), make(chan struct{})
+	m.RegisterSlashCommand("/ucb", func(ctx context.Context, cmd *slack.SlashCommand) {
+		started <- struct{}{}
+		<-release
+	})
+
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/ucb"}})
+	<-started
+	// 第一个在执行, 第二个排队, 第三个拒绝
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/ucb"}})
+	postSlashCommand(m, url.Values{"token": {"verification"}, "command": {"/ucb"}})
+
+	close(release)
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	busy := 0
+	for _, err := range reported {
+		if err == ErrBusy {
+			busy++
+		}
+	}
+	if len(reported) != 3 || busy != 1 {
+		t.Errorf("unexpected results: %v", reported)
+	}
+}
+
+func TestWithWorkersRejectsInvalidArguments(t *testing.T) {
+	for _, args := range [][2]int{{0, 1}, {-1, 1}, {1, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithWorkers(%d, %d) should panic", args[0], args[1])
+				}
+			}()
+			WithWorkers(args[0], time.Duration(args[1])*time.Second)
+		}()
+	}
+}
+
+func TestGo(t *testing.T) {
+	m := New("", "verification", WithWorkers(1, time.Second), WithQueueLimit(1))
+
+	middlewares := 0
+	m.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) error {
+			middlewares++
+			return next(ctx, req)
+		}
+	})
+
+	started, release := make(chan struct{}, 3), make(chan struct{})
+	task := func(ctx context.Context) {
+		started <- struct{}{}
+		<-release
+	}
+
+	if err := m.Go(context.Background(), "refresh", task); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := m.Go(context.Background(), "refresh", task); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Go(context.Background(), "refresh", task); err != ErrBusy {
+		t.Errorf("queue is full, expect ErrBusy: %v", err)
+	}
+
+	close(release)
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(started) != 1 || middlewares != 0 {
+		t.Errorf("started %d, middlewares %d", len(started)+1, middlewares)
+	}
+
+	// 任务的panic只记录
+	if err := m.Go(context.Background(), "panic", func(ctx context.Context) { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,32 +5,101 @@ import (
 	"flag"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	ginadapter "github.com/awslabs/aws-lambda-go-api-proxy/gin"
 	"github.com/chentmin/slackbot/slackbot"
+	"github.com/chentmin/slackbot/slackbot/apigateway"
+	"github.com/chentmin/slackbot/slackbot/ginhandler"
 	"github.com/gin-gonic/gin"
 	"os"
+	"time"
 )
 
-var ginLambda *ginadapter.GinLambda
+var lambdaHandler func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// bot 给需要打开modal的handler使用
+var bot *slackbot.Manager
 
 var (
 	local = flag.String("local", "", "if set, local mode. should be bind addr like :8080")
+	socket = flag.Bool("socket", false, "if set with -local, receive events through socket mode using SLACK_APP_TOKEN")
 )
 
-func newGinRouter() *gin.Engine{
-	r := gin.Default()
-	gin.SetMode(gin.ReleaseMode)
+func newBotManager() *slackbot.Manager{
+	// POLICY_FILE是yaml的权限配置, 没有配置时所有人都能用所有命令
+	var policies slackbot.Policies
+	if path := os.Getenv("POLICY_FILE"); path != ""{
+		var err error
+		if policies, err = slackbot.LoadPolicies(path); err != nil{
+			panic(err)
+		}
+	}
+
+	// 配置了DEDUP_DYNAMO_TABLE时多个lambda实例之间去重, 否则只在进程内去重
+	dedup := slackbot.NewMemoryDedupStore(time.Hour)
+	if table := os.Getenv("DEDUP_DYNAMO_TABLE"); table != ""{
+		dedup = slackbot.NewDynamoDedupStore(table)
+	}
+
+	// BOT_LOCALE是默认语言, 没有配置时是中文. 用户可以用 @bot lang en 切换, 没有切换时用slack里设置的语言
+	locale := os.Getenv("BOT_LOCALE")
+	if locale == ""{
+		locale = slackbot.DefaultLocale
+	}
+
+	// 没有配置SLACK_SIGNING_SECRET时, 退回到verification token校验.
+	// 调用unity的api很慢, handler放到后台执行. -local时先回复slack避免超时重试;
+	// lambda里apigateway.Handler要等handler执行完才返回, slack还是会等, 这里只限制并发和超时
+	botManager := slackbot.New(os.Getenv("SLACK_TOKEN"), os.Getenv("SLACK_VERIFICATION_TOKEN"),
+		slackbot.WithSigningSecret(os.Getenv("SLACK_SIGNING_SECRET")),
+		slackbot.WithPolicies(policies),
+		slackbot.WithDedupStore(dedup),
+		slackbot.WithWorkers(8, time.Minute),
+		// 排队太多时unity也处理不过来, 直接告诉用户稍后再试
+		slackbot.WithQueueLimit(64),
+		slackbot.WithCatalogs(mustCatalogs()),
+		slackbot.WithLocale("", locale),
+		slackbot.WithSlackLocale(),
+		// 私信给bot时不用@bot, 直接发 build ios
+		slackbot.WithDirectMessages())
+
+	botManager.Use(slackbot.Recover(), slackbot.Logging(), replyError)
+
+	mustRegister(botManager.RegisterCommand(buildCommand, processBuildCommand))
+	mustRegister(botManager.RegisterMentionCommand(pingCommand, processPingCommand, slackbot.Name("ping"), slackbot.Description("测试bot是否在线"), slackbot.Usage("ping [text]")))
+	mustRegister(botManager.RegisterCommand(installCommand, processInstallCommand))
 
-	botManager := slackbot.New(os.Getenv("SLACK__TOKEN"), os.Getenv("SLACK_VERIFICATION_TOKEN"))
+	botManager.RegisterAttachmentCallback("cancel_build", processCancelBuild, slackbot.Description("取消构建"))
 
-	botManager.RegisterMentionCommand(buildCommand, processBuildCommand)
-	botManager.RegisterMentionCommand(pingCommand, processPingCommand)
-	botManager.RegisterMentionCommand(installCommand, processInstallCommand)
+	botManager.RegisterSlashCommand("/ucb", processUcbCommand, slackbot.Description("不用@bot, /ucb build打开构建表单"), slackbot.Usage("/ucb [build|install] ..."))
 
-	botManager.RegisterCallback("cancel_build", processCancelBuild)
+	// 能启动构建的入口都用build这个名字, POLICY_FILE里的build一条配置全管住. /ucb build在processUcbCommand里检查
+	// 构建表单的private_metadata是结果要发到的channel, allow_channels按它检查. Home tab上的按钮没有channel, 有channel限制时会私信告诉用户
+	botManager.RegisterViewSubmission(launcherCallbackID, processBuildLauncher, slackbot.Name("build"), slackbot.MetadataChannel(), slackbot.Description("构建表单"))
+	// slack app的设置里要添加Callback ID为rebuild的message shortcut
+	botManager.RegisterMessageShortcut("rebuild", processRebuildShortcut, slackbot.Name("build"), slackbot.Description("重新构建"))
+	// unity的接口很慢, 缓存一会儿, 不用每输入一个字都去查
+	botManager.RegisterOptionsProvider(targetActionID, listBuildTargets, slackbot.CacheOptions(time.Minute))
 
-	r.POST("/message", botManager.HandleMessageEvent)
-	r.POST("/interact", botManager.HandleCallbackEvent)
+	// slack app里要打开Home tab, 订阅app_home_opened
+	botManager.RegisterHomeRenderer(renderHome, slackbot.Description("构建面板"))
+	botManager.RegisterBlockCallback(homeNewBuildActionID, processHomeBuild, slackbot.Name("build"), slackbot.Description("新建构建"))
+	botManager.RegisterBlockCallback(homeBuildActionID, processHomeBuild, slackbot.Name("build"), slackbot.Description("构建目标"))
+
+	bot = botManager
+	return botManager
+}
+
+// mustRegister 命令都是写死的, 注册失败说明代码有问题
+func mustRegister(err error){
+	if err != nil{
+		panic(err)
+	}
+}
+
+func newGinRouter(botManager *slackbot.Manager) *gin.Engine{
+	r := gin.Default()
+	gin.SetMode(gin.ReleaseMode)
+
+	ginhandler.Register(r, botManager)
 	r.GET("/install", handleRedirectManifest)
 	r.GET("/manifest/:tag/:build/manifest.plist", handleInstallManifest)
 	r.GET("/redirect-download/:tag/:build/build.ipa", handleRedirectDownload)
@@ -39,11 +108,12 @@ func newGinRouter() *gin.Engine{
 }
 
 func Handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	// If no name is provided in the HTTP request body, throw an error
-	if ginLambda == nil{
-		ginLambda = ginadapter.New(newGinRouter())
+	if lambdaHandler == nil{
+		botManager := newBotManager()
+		// 返回之前等后台的handler执行完, lambda返回之后进程会被冻结. 所以slack要等handler执行完才收到回复
+		lambdaHandler = apigateway.Handler(newGinRouter(botManager), botManager)
 	}
-	return ginLambda.ProxyWithContext(ctx, req)
+	return lambdaHandler(ctx, req)
 }
 
 func main() {
@@ -52,7 +122,18 @@ func main() {
 	if *local == ""{
 		lambda.Start(Handler)
 	} else{
-		if err := newGinRouter().Run(*local); err != nil{
+		botManager := newBotManager()
+
+		// socket mode不需要slack能访问到本机, 本地调试时不用再开隧道
+		if *socket{
+			go func() {
+				if err := botManager.RunSocketMode(context.Background(), os.Getenv("SLACK_APP_TOKEN")); err != nil{
+					panic(err)
+				}
+			}()
+		}
+
+		if err := newGinRouter(botManager).Run(*local); err != nil{
 			panic(err)
 		}
 	}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/antihax/optional"
+	"github.com/chentmin/slackbot/slackbot"
+	swagger "github.com/chentmin/slackbot/unitycloudbuild/api"
+	"github.com/slack-go/slack"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// homeBuildActionID Home tab上构建目标的按钮, 打开填好目标的构建表单
+	homeBuildActionID    = "home_build:{target}"
+	homeNewBuildActionID = "home_new_build"
+
+	homeRecentBuilds = 10
+	homeMaxTargets   = 10
+
+	// homeDataTTL 连续打开Home tab时不用每次都调unity
+	homeDataTTL = 30 * time.Second
+)
+
+// homeBuildAction 按钮的action id, 和注册的homeBuildActionID对应
+func homeBuildAction(target string) string {
+	return strings.Replace(homeBuildActionID, "{target}", target, 1)
+}
+
+// userTargets 用户通过bot构建过的目标, Home tab上排在前面. 只在内存里, lambda冷启动后就没了
+var userTargets = &recentTargets{users: make(map[string][]string)}
+
+type recentTargets struct {
+	lock  sync.Mutex
+	users map[string][]string
+}
+
+func (r *recentTargets) add(user, target string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	targets := []string{target}
+	for _, t := range r.users[user] {
+		if t != target && len(targets) < homeMaxTargets {
+			targets = append(targets, t)
+		}
+	}
+	r.users[user] = targets
+}
+
+func (r *recentTargets) get(user string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]string(nil), r.users[user]...)
+}
+
+// homeData Home tab上和用户无关的unity数据, 所有人共用一份. 刷新时给N个人发布也只调一次unity
+var homeData = &homeCache{}
+
+type homeCache struct {
+	lock    sync.Mutex
+	targets []swagger.InlineResponse2006
+	builds  []swagger.OrgsOrgidProjectsProjectidBuildtargetsBuilds
+	expire  time.Time
+}
+
+func (h *homeCache) get(ctx context.Context) ([]swagger.InlineResponse2006, []swagger.OrgsOrgidProjectsProjectidBuildtargetsBuilds, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if time.Now().Before(h.expire) {
+		return h.targets, h.builds, nil
+	}
+
+	client := unityClient()
+
+	targets, _, err := client.BuildtargetsApi.OrgsOrgidProjectsProjectidBuildtargetsGet(ctx, UNITY_ORG, UNITY_PROJECT, nil)
+	if err != nil {
+		return nil, nil, slackbot.NewLocalizedError("调用unity接口出错: %s", err)
+	}
+
+	builds, _, err := client.BuildsApi.GetBuilds(ctx, UNITY_ORG, UNITY_PROJECT, "_all", &swagger.GetBuildsOpts{PerPage: optional.NewFloat32(homeRecentBuilds)})
+	if err != nil {
+		return nil, nil, slackbot.NewLocalizedError("调用unity接口出错: %s", err)
+	}
+
+	h.targets, h.builds, h.expire = targets, builds, time.Now().Add(homeDataTTL)
+	return targets, builds, nil
+}
+
+// invalidate 构建状态变了, 下次get重新调unity
+func (h *homeCache) invalidate() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.expire = time.Time{}
+}
+
+// renderHome 最近的构建和常用的构建目标, 每个目标一个构建按钮
+func renderHome(ctx context.Context, user string) (*slack.HomeTabViewRequest, error) {
+	c := slackbot.FromContext(ctx)
+
+	targets, builds, err := homeData.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b := slackbot.Blocks().
+		Header(c.T("构建")).
+		Actions(slackbot.Button(homeNewBuildActionID, c.T("新建构建")).Primary()).
+		Header(c.T("你的构建目标"))
+
+	names := make(map[string]string)
+	for _, target := range targets {
+		if target.Enabled {
+			names[target.Buildtargetid] = target.Name
+		}
+	}
+
+	// 构建过的排前面, 没构建过时列出所有能构建的
+	shown := 0
+	addTarget := func(id string) {
+		name, ok := names[id]
+		if !ok || shown >= homeMaxTargets {
+			return
+		}
+		delete(names, id)
+		shown++
+		b.Section(slackbot.Mrkdwn("*" + slackbot.EscapeMrkdwn(name) + "*")).
+			Accessory(slackbot.Button(homeBuildAction(id), c.T("开始构建")))
+	}
+	for _, id := range userTargets.get(user) {
+		addTarget(id)
+	}
+	for _, target := range targets {
+		addTarget(target.Buildtargetid)
+	}
+	if shown == 0 {
+		b.Context(slackbot.Mrkdwn(c.T("没有能构建的目标")))
+	}
+
+	b.Header(c.T("最近的构建"))
+	if len(builds) == 0 {
+		b.Context(slackbot.Mrkdwn(c.T("还没有构建")))
+	}
+	for _, build := range builds {
+		b.Context(slackbot.Mrkdwn(fmt.Sprintf("*%s* #%v  `%s`  %s", slackbot.EscapeMrkdwn(build.BuildTargetName), build.Build, build.BuildStatus, build.Created)))
+	}
+
+	return slackbot.NewHomeView(b.Build()), nil
+}
+
+// processHomeBuild Home tab上没有channel, 构建结果私信给点按钮的人
+func processHomeBuild(ctx context.Context, action *slack.BlockAction, fullCallback slack.InteractionCallback) {
+	c := slackbot.FromContext(ctx)
+
+	if err := openBuildLauncher(ctx, bot, fullCallback.TriggerID, c.User, c.Params["target"]); err != nil {
+		slackbot.ReportError(ctx, err)
+	}
+}
+
+// homeRefresh 已经有一次刷新在排队时不再加, 构建和取消的handler不用等刷新
+var homeRefresh struct {
+	sync.Mutex
+	pending bool
+}
+
+// refreshHome 构建状态变了, 打开过Home tab的人都更新一下. 在bot自己的后台任务里执行, 不算触发的用户的请求,
+// 排队中的刷新会合并
+func refreshHome(ctx context.Context) {
+	homeRefresh.Lock()
+	pending := homeRefresh.pending
+	homeRefresh.pending = true
+	homeRefresh.Unlock()
+
+	if pending {
+		return
+	}
+
+	err := bot.Go(ctx, "refresh_home", func(ctx context.Context) {
+		// 开始刷新之后的变化要再刷新一次
+		setHomeRefreshDone()
+
+		homeData.invalidate()
+		if err := bot.RefreshHome(ctx); err != nil {
+			bot.Logger().Warn("更新Home tab失败", slackbot.Fields{"error": err})
+		}
+	})
+	if err != nil {
+		// 没排上队, 下次构建状态变化时再刷新
+		setHomeRefreshDone()
+	}
+}
+
+func setHomeRefreshDone() {
+	homeRefresh.Lock()
+	homeRefresh.pending = false
+	homeRefresh.Unlock()
+}
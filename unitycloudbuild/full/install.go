@@ -3,18 +3,25 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"github.com/chentmin/slackbot/slackbot"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"os"
+	"strings"
 	"text/template"
 )
 
+// requestLocale 安装页面在手机的浏览器里打开, 没有slack用户, 按Accept-Language选择语言
+func requestLocale(c *gin.Context) string{
+	return strings.SplitN(c.GetHeader("Accept-Language"), ",", 2)[0]
+}
+
 func handleRedirectManifest(c *gin.Context){
 	tag := c.Query("tag")
 	buildNumber := c.Query("build")
 
 	if tag == "" || buildNumber == ""{
-		c.String(http.StatusBadRequest, "tag或build不存在")
+		c.String(http.StatusBadRequest, bot.T(requestLocale(c), "tag或build不存在"))
 		return
 	}
 
@@ -35,28 +42,28 @@ func handleRedirectDownload(c *gin.Context){
 	buildNumber := c.Param("build")
 
 	if tag == "" || buildNumber == ""{
-		c.String(http.StatusBadRequest, "tag或build不存在")
+		c.String(http.StatusBadRequest, bot.T(requestLocale(c), "tag或build不存在"))
 		return
 	}
 
 	result, _, err := unityClient().BuildsApi.GetBuild(c, UNITY_ORG, UNITY_PROJECT, tag, buildNumber, nil)
 	if err != nil{
-		fmt.Printf("unity返回错误: %s\n", err)
-		c.String(http.StatusBadRequest, fmt.Sprintf("unity返回错误: %s\n", err))
+		bot.Logger().Error("unity返回错误", slackbot.Fields{"tag": tag, "build": buildNumber, "error": err})
+		c.String(http.StatusBadRequest, bot.T(requestLocale(c), "unity返回错误: %s", err))
 		return
 	}
 
 	switch result.BuildStatus {
 	case "success":
-		fmt.Printf("result: %+v\n", result)
+		bot.Logger().Info("获取构建成功", slackbot.Fields{"tag": tag, "build": buildNumber})
 
 		url := result.Links.DownloadUrl.Href
 
 		c.Redirect(http.StatusTemporaryRedirect, url)
 
 	default:
-		fmt.Printf("当前不是success状态: %+v", result)
-		c.String(http.StatusOK, "当前不是success状态")
+		bot.Logger().Info("当前不是success状态", slackbot.Fields{"tag": tag, "build": buildNumber, "status": result.BuildStatus})
+		c.String(http.StatusOK, bot.T(requestLocale(c), "当前不是success状态"))
 	}
 }
 
@@ -65,20 +72,20 @@ func handleInstallManifest(c *gin.Context){
 	buildNumber := c.Param("build")
 
 	if tag == "" || buildNumber == ""{
-		c.String(http.StatusBadRequest, "tag或build不存在")
+		c.String(http.StatusBadRequest, bot.T(requestLocale(c), "tag或build不存在"))
 		return
 	}
 
 	result, _, err := unityClient().BuildsApi.GetBuild(c, UNITY_ORG, UNITY_PROJECT, tag, buildNumber, nil)
 	if err != nil{
-		fmt.Printf("unity返回错误: %s\n", err)
-		c.String(http.StatusBadRequest, fmt.Sprintf("unity返回错误: %s\n", err))
+		bot.Logger().Error("unity返回错误", slackbot.Fields{"tag": tag, "build": buildNumber, "error": err})
+		c.String(http.StatusBadRequest, bot.T(requestLocale(c), "unity返回错误: %s", err))
 		return
 	}
 
 	switch result.BuildStatus {
 	case "success":
-		fmt.Printf("result: %+v\n", result)
+		bot.Logger().Info("获取构建成功", slackbot.Fields{"tag": tag, "build": buildNumber})
 
 		url := fmt.Sprintf("%s/redirect-download/%s/%s/build.ipa", os.Getenv("SELF_URL"), tag, buildNumber)
 		bundleId := result.ProjectVersion.BundleId
@@ -95,15 +102,15 @@ func handleInstallManifest(c *gin.Context){
 		b := &bytes.Buffer{}
 
 		if err := intmp.Execute(b, info); err != nil{
-			fmt.Printf("template 出错: %s\n", err)
+			bot.Logger().Error("template出错", slackbot.Fields{"error": err})
 			return
 		}
 
 		c.Data(http.StatusOK, "text/xml", b.Bytes())
 
 	default:
-		fmt.Printf("当前不是success状态: %+v", result)
-		c.String(http.StatusOK, "当前不是success状态")
+		bot.Logger().Info("当前不是success状态", slackbot.Fields{"tag": tag, "build": buildNumber, "status": result.BuildStatus})
+		c.String(http.StatusOK, bot.T(requestLocale(c), "当前不是success状态"))
 	}
 }
 
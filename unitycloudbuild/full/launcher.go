@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/slack-go/slack"
+	"io/fs"
+	"strings"
+)
+
+const (
+	launcherCallbackID = "build_launcher"
+	// targetActionID 构建表单里选择构建目标的external select
+	targetActionID = "build_target"
+)
+
+// templateFiles 构建表单之类的block template, 编译进程序里, lambda不需要再打包这些文件
+//
+//go:embed templates
+var templateFiles embed.FS
+
+// templates 构建表单, 取代 build tag [clean] 的手打命令
+var templates = mustTemplates()
+
+func mustTemplates() *slackbot.BlockTemplates {
+	dir, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	result, err := slackbot.LoadBlockTemplatesFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// openBuildLauncher 打开构建表单, 构建结果发到发起命令的channel
+func openBuildLauncher(ctx context.Context, bot *slackbot.Manager, triggerID, channel, tag string) error {
+	c := slackbot.FromContext(ctx)
+	blocks, err := templates.Render("launcher", map[string]string{"Tag": tag}, c.T)
+	if err != nil {
+		return err
+	}
+
+	view := slackbot.NewModalViewWithBlocks(launcherCallbackID, c.T("新建构建"), c.T("开始构建"), blocks)
+
+	view.PrivateMetadata = channel
+
+	_, err = bot.OpenModal(ctx, triggerID, view)
+	return err
+}
+
+func processBuildLauncher(ctx context.Context, view *slack.View, action slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	c := slackbot.FromContext(ctx)
+
+	tag := view.State.Values["tag"][targetActionID].SelectedOption.Value
+	if tag == "" {
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{"tag": c.T("请选择一个构建目标")})
+	}
+
+	clean := false
+	for _, option := range view.State.Values["clean"]["value"].SelectedOptions {
+		if option.Value == "clean" {
+			clean = true
+		}
+	}
+
+	// 调用unity很慢, 超过3秒modal会显示出错. 先关掉modal, 构建在后台启动, 出错时发到发起表单的channel
+	channel := view.PrivateMetadata
+	slackbot.Background(ctx, func(ctx context.Context) {
+		if err := triggerUnityBuild(ctx, tag, clean, "", channel); err != nil {
+			c.Logger.Warn("表单启动构建失败", slackbot.Fields{"tag": tag, "error": err})
+			replyLauncherError(slackbot.FromContext(ctx), channel, err)
+		}
+	})
+
+	return nil
+}
+
+// replyLauncherError modal已经关了, 只回复给提交的人. 从Home tab打开的表单channel是用户自己, 只能私信
+func replyLauncherError(c *slackbot.Context, channel string, err error) {
+	msg := slack.MsgOptionText(c.ErrorText(err), false)
+	if channel == c.User {
+		c.Client.PostMessageContext(c, channel, msg)
+		return
+	}
+	c.Client.PostEphemeralContext(c, channel, c.User, msg)
+}
+
+// processRebuildShortcut 构建通知的消息上的 "Rebuild this" shortcut, 打开填好构建目标的构建表单.
+// 构建目标从取消按钮签过名的value里取, 取消过的构建通知没有按钮, 不能重新构建
+func processRebuildShortcut(ctx context.Context, triggerID string, message *slack.Message, action slack.InteractionCallback) {
+	c := slackbot.FromContext(ctx)
+
+	tag := ""
+	for _, attachment := range message.Attachments {
+		for _, a := range attachment.Actions {
+			var state cancelState
+			if attachment.CallbackID == "cancel_build" && bot.DecodeState(a.Value, &state) == nil {
+				tag = state.Target
+			}
+		}
+	}
+
+	if tag == "" {
+		c.ReplyEphemeral(c.T("这条消息不是构建通知, 或者构建已经取消了"))
+		return
+	}
+
+	if err := openBuildLauncher(ctx, bot, triggerID, c.Channel, tag); err != nil {
+		slackbot.ReportError(ctx, err)
+	}
+}
+
+// listBuildTargets 构建表单里边输入边搜索unity上的构建目标, 只列出能构建的
+func listBuildTargets(ctx context.Context, query string, action slack.InteractionCallback) ([]*slack.OptionBlockObject, error) {
+	targets, _, err := unityClient().BuildtargetsApi.OrgsOrgidProjectsProjectidBuildtargetsGet(ctx, UNITY_ORG, UNITY_PROJECT, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	var result []*slack.OptionBlockObject
+	for _, target := range targets {
+		if !target.Enabled {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(target.Name), query) && !strings.Contains(target.Buildtargetid, query) {
+			continue
+		}
+		result = append(result, slackbot.Option(target.Buildtargetid, target.Name))
+	}
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/chentmin/slackbot/slackbot"
+)
+
+// messages 代码里的中文是原文, 这里只需要写其它语言的翻译
+const messages = `
+en:
+  "新建构建": "Start a build"
+  "获得安装二维码": "Get the install QR code"
+  "构建目标": "Build target"
+  "构建序号": "Build number"
+  "指定commit": "Build a specific commit"
+  "测试bot是否在线": "Check whether the bot is online"
+  "取消构建": "Cancel a build"
+  "重新构建": "Rebuild this"
+  "构建面板": "Build dashboard"
+  "这条消息不是构建通知, 或者构建已经取消了": "This message is not a build notification, or the build was cancelled"
+  "不用@bot, /ucb build打开构建表单": "No @bot needed, /ucb build opens the build form"
+  "构建表单": "Build form"
+  "选项": "Options"
+  "输入名字搜索": "Type to search"
+  "开始构建": "Build"
+  "请选择一个构建目标": "Please choose a build target"
+  "未知的命令": "Unknown command"
+  "确认": "Confirm"
+  "取消": "Cancel"
+  "确定要取消构建吗?": "Are you sure you want to cancel this build?"
+  "启动成功: %s %v": "Build started: %s %v"
+  "%s %s 已取消 by @%s": "%s %s cancelled by @%s"
+  "取消失败: %s": "Failed to cancel: %s"
+  "生成二维码失败: %s": "Failed to generate the QR code: %s"
+  "上传图片失败: %s": "Failed to upload the image: %s"
+  "调用unity接口出错: %s": "Unity API call failed: %s"
+  "调用unity接口出错: result: %s error: %v": "Unity API call failed: result: %s error: %v"
+  "unity没有返回错误, 也没有返回payload...": "Unity returned neither an error nor a payload..."
+  "unity返回错误: build: %v: %s": "Unity returned an error: build: %v: %s"
+  "unity返回错误: %s": "Unity returned an error: %s"
+  "tag或build不存在": "tag or build is missing"
+  "当前不是success状态": "The build has not succeeded yet"
+  "构建": "Builds"
+  "你的构建目标": "Your build targets"
+  "没有能构建的目标": "No build targets available"
+  "最近的构建": "Recent builds"
+  "还没有构建": "No builds yet"
+`
+
+func mustCatalogs() slackbot.Catalogs {
+	catalogs, err := slackbot.ParseCatalogs([]byte(messages))
+	if err != nil {
+		panic(err)
+	}
+	return catalogs
+}
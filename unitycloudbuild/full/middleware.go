@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"github.com/chentmin/slackbot/slackbot"
+	"github.com/pkg/errors"
+)
+
+// replyError handler通过slackbot.ReportError报告的错误, 统一回复给发起的人. 没有权限的slackbot已经回复过了
+func replyError(next slackbot.Handler) slackbot.Handler {
+	return func(ctx context.Context, req *slackbot.Request) error {
+		err := next(ctx, req)
+		if err != nil && !errors.Is(err, slackbot.ErrDenied) && req.Channel != "" && req.User != "" {
+			c := slackbot.FromContext(ctx)
+			c.ReplyEphemeral(c.ErrorText(err))
+		}
+		return err
+	}
+}
@@ -6,97 +6,160 @@ import (
 	"fmt"
 
 	"github.com/antihax/optional"
+	"github.com/chentmin/slackbot/slackbot"
 	swagger "github.com/chentmin/slackbot/unitycloudbuild/api"
 	"github.com/pkg/errors"
 	qrcode "github.com/skip2/go-qrcode"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"os"
+	"strconv"
 
 	"strings"
+	"time"
 )
 
 var (
-	buildCommand   = `<@.+> build (\S+)( clean)?`
-	pingCommand    = `<@.+> ping(.*)`
-	installCommand = `<@.+> install (\S+) (\S+)`
+	pingCommand = `<@.+> ping(.*)`
+
+	buildCommand = slackbot.CommandSpec{
+		Name:        "build",
+		Description: "新建构建",
+		Args:        buildArgs{},
+	}
+	installCommand = slackbot.CommandSpec{
+		Name:        "install",
+		Description: "获得安装二维码",
+		Args:        installArgs{},
+	}
 
-	TOKEN         = os.Getenv("SLACK_TOKEN")
-	api           = slack.New(TOKEN)
 	UNITY_ORG     = os.Getenv("UNITY_ORG")
 	UNITY_PROJECT = os.Getenv("UNITY_PROJECT")
-
-	help = `未知的命令
-build tag [clean] 新建构建
-install tag number 获得安装二维码
-`
 )
 
-func processCancelBuild(ctx context.Context, action slack.InteractionCallback) {
-	if action.ActionCallback.AttachmentActions == nil {
-		fmt.Printf("没有actions字段\n")
-		return
-	}
+// cancelState 取消按钮的value, 签名过, 用户改不了
+type cancelState struct {
+	Build  string `json:"b"`
+	Target string `json:"t"`
+}
 
-	if l := len(action.ActionCallback.AttachmentActions); l == 0 {
-		fmt.Printf("没有actions字段\n")
-		return
-	} else if l > 1 {
-		fmt.Printf("竟然超过了1个actions, 有%d个, 取第1个\n", l)
-	}
+// cancelStateTTL 超过这个时间的构建早就结束了, 不用再取消
+const cancelStateTTL = 24 * time.Hour
 
-	click := action.ActionCallback.AttachmentActions[0]
+func processCancelBuild(ctx context.Context, click *slack.AttachmentAction, action slack.InteractionCallback) {
+	c := slackbot.FromContext(ctx)
 
-	value := click.Value
-	fmt.Printf("取消构建: %s\n", value)
-	v := strings.SplitN(value, "_", 2)
-	if len(v) != 2 {
-		fmt.Printf("value malform: %s\n", value)
+	var state cancelState
+	if err := c.DecodeState(click.Value, &state); err != nil {
 		return
 	}
 
-	buildNum := v[0]
-	tag := v[1]
-	if err := triggerUnityCancel(ctx, tag, buildNum, action); err != nil {
-		fmt.Printf("取消失败: %s\n", err)
+	buildNum, tag := state.Build, state.Target
+	c.Logger.Info("取消构建", slackbot.Fields{"build": buildNum, "tag": tag})
+
+	if err := triggerUnityCancel(ctx, tag, buildNum); err != nil {
+		slackbot.ReportError(ctx, slackbot.NewLocalizedError("取消失败: %s", err))
 		return
 	}
+
+	emptySlice := make([]slack.Attachment, 0)
+	c.UpdateOriginal(c.T("%s %s 已取消 by @%s", tag, buildNum, action.User.Name), slack.MsgOptionAttachments(emptySlice...))
+	refreshHome(ctx)
+}
+
+type buildArgs struct {
+	Target string `arg:"target" desc:"构建目标" validate:"required"`
+	Clean  bool   `flag:"clean" desc:"clean build"`
+	Commit string `flag:"commit" desc:"指定commit" validate:"omitempty,alphanum"`
+}
+
+type installArgs struct {
+	Target string `arg:"target" desc:"构建目标" validate:"required"`
+	Build  int    `arg:"build" desc:"构建序号" validate:"required,min=1"`
 }
 
-func processInstallCommand(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
-	tag := cmd[1]
-	buildNumber := cmd[2]
+func processInstallCommand(ctx context.Context, ev *slackevents.AppMentionEvent, args interface{}) {
+	a := args.(*installArgs)
+	postInstallQRCode(slackbot.FromContext(ctx), a.Target, strconv.Itoa(a.Build))
+}
 
+func postInstallQRCode(c *slackbot.Context, tag, buildNumber string) {
 	url := fmt.Sprintf("%s/install?tag=%s&build=%s", os.Getenv("SELF_URL"), tag, buildNumber)
 
-	fmt.Printf("image url: %s\n", url)
+	c.Logger.Info("生成安装二维码", slackbot.Fields{"url": url})
 
 	png, err := qrcode.Encode(url, qrcode.Medium, 256)
 	if err != nil {
-		fmt.Printf("生成二维码失败: %s\n", err)
-		api.PostMessage(ev.Channel, slack.MsgOptionPostEphemeral(ev.User), slack.MsgOptionText(fmt.Sprintf("生成二维码失败: %s\n", err), false))
+		c.Logger.Error("生成二维码失败", slackbot.Fields{"error": err})
+		c.ReplyEphemeral(c.T("生成二维码失败: %s", err))
+		return
+	}
+
+	if _, err := c.UploadFile(fmt.Sprintf("%s_%s.png", buildNumber, tag), bytes.NewBuffer(png), ""); err != nil {
+		c.Logger.Error("上传图片失败", slackbot.Fields{"error": err})
+		c.ReplyEphemeral(c.T("上传图片失败: %s", err))
+		return
+	}
+}
+
+// processUcbCommand 处理 /ucb build tag [--clean] [--commit=xxx] 和 /ucb install tag number, 参数和 @bot build, @bot install
+// 用同一个CommandSpec解析和校验. 只有 /ucb build 时打开构建表单
+func processUcbCommand(ctx context.Context, s *slack.SlashCommand) {
+	c := slackbot.FromContext(ctx)
+
+	// 每个分支按对应的命令名检查权限, 和 @bot build, @bot install 用同一条配置
+	words := strings.Fields(s.Text)
+	if len(words) == 0 || (len(words) == 1 && words[0] == buildCommand.Name) {
+		if c.Authorize("build") != nil {
+			return
+		}
+		if err := openBuildLauncher(ctx, bot, s.TriggerID, s.ChannelID, ""); err != nil {
+			slackbot.ReportError(ctx, err)
+		}
 		return
 	}
 
-	if _, err := api.UploadFile(slack.FileUploadParameters{
-		Reader:          bytes.NewBuffer(png),
-		Filetype:        "png",
-		Filename:        fmt.Sprintf("%s_%s.png", buildNumber, tag),
-		Channels:        []string{ev.Channel},
-		ThreadTimestamp: ev.ThreadTimeStamp,
-	}); err != nil {
-		fmt.Printf("上传图片失败: %s\n", err)
-		api.PostMessage(ev.Channel, slack.MsgOptionPostEphemeral(ev.User), slack.MsgOptionText(fmt.Sprintf("上传图片失败: %s\n", err), false))
+	switch words[0] {
+	case buildCommand.Name:
+		if c.Authorize("build") != nil {
+			return
+		}
+		args, err := slackbot.ParseCommand(buildCommand, s.Text)
+		if err != nil {
+			c.ReplyEphemeral(c.ErrorText(err))
+			return
+		}
+		a := args.(*buildArgs)
+		if err := triggerUnityBuild(ctx, a.Target, a.Clean, a.Commit, s.ChannelID); err != nil {
+			slackbot.ReportError(ctx, err)
+		}
+		return
+
+	case installCommand.Name:
+		if c.Authorize("install") != nil {
+			return
+		}
+		args, err := slackbot.ParseCommand(installCommand, s.Text)
+		if err != nil {
+			c.ReplyEphemeral(c.ErrorText(err))
+			return
+		}
+		a := args.(*installArgs)
+		postInstallQRCode(c, a.Target, strconv.Itoa(a.Build))
 		return
 	}
+
+	// 和 @bot help 一样, 从注册的命令生成
+	blocks, _ := bot.HelpBlocks(c.Locale(), "")
+	c.ReplyEphemeral(c.T("未知的命令"), slack.MsgOptionBlocks(blocks...))
 }
 
-func processBuildCommand(ctx context.Context, ev *slackevents.AppMentionEvent, cmd []string) {
-	tag := cmd[1]
-	clean := len(cmd) > 2 && cmd[2] == " clean"
+func processBuildCommand(ctx context.Context, ev *slackevents.AppMentionEvent, args interface{}) {
+	a := args.(*buildArgs)
 
-	if err := triggerUnityBuild(ctx, tag, clean, ev.Channel); err != nil {
-		api.PostMessage(ev.Channel, slack.MsgOptionText(err.Error(), false))
+	if err := triggerUnityBuild(ctx, a.Target, a.Clean, a.Commit, ev.Channel); err != nil {
+		c := slackbot.FromContext(ctx)
+		c.Reply(c.ErrorText(err))
 	}
 }
 
@@ -105,7 +168,8 @@ func processPingCommand(ctx context.Context, ev *slackevents.AppMentionEvent, cm
 	if len(cmd) > 1 && cmd[1] != "" {
 		msg = cmd[1]
 	}
-	api.PostMessage(ev.Channel, slack.MsgOptionText(msg, false))
+	c := slackbot.FromContext(ctx)
+	c.Reply(msg)
 
 	attachment := slack.Attachment{
 		Pretext:    "",
@@ -130,7 +194,7 @@ func processPingCommand(ctx context.Context, ev *slackevents.AppMentionEvent, cm
 	}
 
 	message := slack.MsgOptionAttachments(attachment)
-	api.PostMessage(ev.Channel, slack.MsgOptionText(msg, false), message)
+	c.Reply(msg, message)
 }
 
 func unityClient() *swagger.APIClient {
@@ -145,46 +209,41 @@ func unityClient() *swagger.APIClient {
 	return client
 }
 
-func triggerUnityCancel(ctx context.Context, tag string, buildNumber string, action slack.InteractionCallback) error {
+func triggerUnityCancel(ctx context.Context, tag string, buildNumber string) error {
 	client := unityClient()
 
 	result, _, err := client.BuildsApi.CancelBuild(ctx, UNITY_ORG, UNITY_PROJECT, tag, buildNumber)
 
 	if err != nil || strings.TrimSpace(result) != "" {
-		fmt.Printf("取消result: %s error: %s\n", result, err)
-		api.PostMessage(action.Channel.ID, slack.MsgOptionPostEphemeral(action.User.ID), slack.MsgOptionText(fmt.Sprintf("调用unity接口出错: result: %s error: %s", result, err.Error()), false))
-
-		return errors.Wrap(err, "调用unity接口出错")
+		// err为nil但result不为空时也是出错了
+		return slackbot.NewLocalizedError("调用unity接口出错: result: %s error: %v", result, err)
 	}
 
-	emptySlice := make([]slack.Attachment, 0)
-	api.UpdateMessageContext(ctx, action.Channel.ID, action.OriginalMessage.Timestamp, slack.MsgOptionText(fmt.Sprintf("%s %s 已取消 by @%s", tag, buildNumber, action.User.Name), false), slack.MsgOptionAttachments(emptySlice...))
 	return nil
 }
 
-func triggerUnityBuild(ctx context.Context, tag string, clean bool, slackChannel string) error {
+func triggerUnityBuild(ctx context.Context, tag string, clean bool, commit string, slackChannel string) error {
 	client := unityClient()
 
 	option := &swagger.StartBuildsOpts{
 		Options: optional.NewInterface(swagger.InlineObject9{
-			Clean: clean,
-			Delay: 5,
+			Clean:  clean,
+			Delay:  5,
+			Commit: commit,
 		}),
 	}
 
 	builds, _, err := client.BuildsApi.StartBuilds(ctx, UNITY_ORG, UNITY_PROJECT, tag, option)
 
 	if err != nil {
-		return errors.Wrap(err, "调用unity接口出错")
+		return slackbot.NewLocalizedError("调用unity接口出错: %s", err)
 	}
 
 	if payload := builds; payload == nil || len(payload) == 0 {
-		return errors.New("unity没有返回错误, 也没有返回payload...")
+		return slackbot.NewLocalizedError("unity没有返回错误, 也没有返回payload...")
 	} else {
-		fmt.Printf("收到%d个payload\n", len(payload))
-
 		for i, p := range payload {
-			fmt.Printf("payload[%d] build: %v, error: %s\n", i, p.Build, p.Error)
+			bot.Logger().Info("unity返回构建结果", slackbot.Fields{"tag": tag, "index": i, "build": p.Build, "error": p.Error})
 			if i > 0 {
 				continue
 			}
@@ -193,23 +252,30 @@ func triggerUnityBuild(ctx context.Context, tag string, clean bool, slackChannel
 					return nil
 				}
 
-				return errors.New(fmt.Sprintf("unity返回错误: build: %v: %s", p.Build, err))
+				return slackbot.NewLocalizedError("unity返回错误: build: %v: %s", p.Build, err)
+			}
+
+			c := slackbot.FromContext(ctx)
+
+			value, err := c.EncodeState(cancelState{Build: fmt.Sprint(p.Build), Target: tag}, cancelStateTTL)
+			if err != nil {
+				return err
 			}
 
 			attachment := slack.Attachment{
-				Pretext:    fmt.Sprintf("启动成功: %s %v", tag, p.Build),
-				Fallback:   fmt.Sprintf("启动成功: %s %v", tag, p.Build),
+				Pretext:    c.T("启动成功: %s %v", tag, p.Build),
+				Fallback:   c.T("启动成功: %s %v", tag, p.Build),
 				CallbackID: "cancel_build",
 				Color:      "#3AA3E3",
 				Actions: []slack.AttachmentAction{
 					slack.AttachmentAction{
 						Name:  "cancel",
-						Text:  "取消",
+						Text:  c.T("取消"),
 						Type:  "button",
-						Value: fmt.Sprintf("%v_%s", p.Build, tag),
+						Value: value,
 						Confirm: &slack.ConfirmationField{
-							Title:       "确认",
-							Text:        "确定要取消构建吗?",
+							Title:       c.T("确认"),
+							Text:        c.T("确定要取消构建吗?"),
 							OkText:      "Yes",
 							DismissText: "No",
 						},
@@ -218,7 +284,11 @@ func triggerUnityBuild(ctx context.Context, tag string, clean bool, slackChannel
 			}
 
 			message := slack.MsgOptionAttachments(attachment)
-			api.PostMessage(slackChannel, message)
+			// 表单提交时没有消息所在的channel, 发到表单里记录的channel
+			bot.Client().PostMessageContext(ctx, slackChannel, message)
+
+			userTargets.add(c.User, tag)
+			refreshHome(ctx)
 		}
 
 		return nil